@@ -1,6 +1,7 @@
 package nightscout
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -38,19 +39,112 @@ type (
 	DeviceStatus struct {
 		CreatedAt time.Time `json:"created_at"`
 		Device    string    `json:"device"`
-		Openaps   Openaps   `json:"openaps,omitempty"`
-		Pump      Pump      `json:"pump,omitempty"`
-		Uploader  Uploader  `json:"uploader,omitempty"`
+		// Openaps, Pump, and Uploader are omitted when empty.
+		Openaps  Openaps  `json:"openaps,omitempty"`
+		Loop     *Loop    `json:"loop,omitempty"`
+		Pump     Pump     `json:"pump,omitempty"`
+		Uploader Uploader `json:"uploader,omitempty"`
+		Extra    Extra    `json:"-"`
 	}
 
+	// Extra holds the JSON fields of a record that are not otherwise represented,
+	// so that they are preserved when the record is uploaded again.
+	Extra map[string]json.RawMessage
+
 	// Openaps represents the openaps data in a DeviceStatus record.
 	Openaps struct {
-		IOB IOB `json:"iob"`
+		IOB       IOB            `json:"iob"`
+		Suggested *Determination `json:"suggested,omitempty"`
+		Enacted   *Determination `json:"enacted,omitempty"`
+		Extra     Extra          `json:"-"`
 	}
 
 	// IOB represents the insulin-on-board data in an Openaps record.
 	IOB struct {
-		IOB Insulin `json:"iob"`
+		IOB      Insulin    `json:"iob"`
+		BasalIOB *Insulin   `json:"basaliob,omitempty"`
+		BolusIOB *Insulin   `json:"bolusiob,omitempty"`
+		Activity *float64   `json:"activity,omitempty"`
+		Time     *time.Time `json:"time,omitempty"`
+		Extra    Extra      `json:"-"`
+	}
+
+	// Determination represents the suggested or enacted data in an Openaps record.
+	Determination struct {
+		Timestamp        *time.Time  `json:"timestamp,omitempty"`
+		DeliverAt        *time.Time  `json:"deliverAt,omitempty"`
+		BG               float64     `json:"bg,omitempty"`
+		Tick             interface{} `json:"tick,omitempty"` // string such as "+3" or number
+		EventualBG       float64     `json:"eventualBG,omitempty"`
+		TargetBG         float64     `json:"targetBG,omitempty"`
+		InsulinReq       *Insulin    `json:"insulinReq,omitempty"`
+		SensitivityRatio *float64    `json:"sensitivityRatio,omitempty"`
+		COB              *float64    `json:"COB,omitempty"`
+		IOB              *Insulin    `json:"IOB,omitempty"`
+		PredBGs          *PredBGs    `json:"predBGs,omitempty"`
+		Reason           string      `json:"reason,omitempty"`
+		Temp             string      `json:"temp,omitempty"`
+		Rate             *Insulin    `json:"rate,omitempty"`
+		Duration         *int        `json:"duration,omitempty"` // minutes
+		Units            *Insulin    `json:"units,omitempty"`    // SMB
+		Received         *bool       `json:"received,omitempty"`
+		Extra            Extra       `json:"-"`
+	}
+
+	// PredBGs represents the predicted glucose curves in a Determination,
+	// at 5-minute intervals.
+	PredBGs struct {
+		IOB   []float64 `json:"IOB,omitempty"`
+		ZT    []float64 `json:"ZT,omitempty"`
+		COB   []float64 `json:"COB,omitempty"`
+		UAM   []float64 `json:"UAM,omitempty"`
+		Extra Extra     `json:"-"`
+	}
+
+	// Loop represents the Loop data in a DeviceStatus record.
+	Loop struct {
+		Name             string         `json:"name,omitempty"`
+		Version          string         `json:"version,omitempty"`
+		Timestamp        *time.Time     `json:"timestamp,omitempty"`
+		IOB              *LoopIOB       `json:"iob,omitempty"`
+		COB              *LoopCOB       `json:"cob,omitempty"`
+		Predicted        *LoopPredicted `json:"predicted,omitempty"`
+		Enacted          *LoopEnacted   `json:"enacted,omitempty"`
+		RecommendedBolus *Insulin       `json:"recommendedBolus,omitempty"`
+		FailureReason    string         `json:"failureReason,omitempty"`
+		Extra            Extra          `json:"-"`
+	}
+
+	// LoopIOB represents the insulin-on-board data in a Loop record.
+	LoopIOB struct {
+		IOB       Insulin    `json:"iob"`
+		Timestamp *time.Time `json:"timestamp,omitempty"`
+		Extra     Extra      `json:"-"`
+	}
+
+	// LoopCOB represents the carbs-on-board data in a Loop record.
+	LoopCOB struct {
+		COB       float64    `json:"cob"`
+		Timestamp *time.Time `json:"timestamp,omitempty"`
+		Extra     Extra      `json:"-"`
+	}
+
+	// LoopPredicted represents the predicted glucose curve in a Loop record,
+	// at 5-minute intervals.
+	LoopPredicted struct {
+		StartDate time.Time `json:"startDate"`
+		Values    []float64 `json:"values"`
+		Extra     Extra     `json:"-"`
+	}
+
+	// LoopEnacted represents the enacted temp basal in a Loop record.
+	LoopEnacted struct {
+		Rate        Insulin    `json:"rate"`
+		Duration    float64    `json:"duration"` // minutes
+		Timestamp   *time.Time `json:"timestamp,omitempty"`
+		Received    bool       `json:"received"`
+		BolusVolume *Insulin   `json:"bolusVolume,omitempty"`
+		Extra       Extra      `json:"-"`
 	}
 
 	// Pump represents the pump data in a DeviceStatus record.
@@ -59,11 +153,16 @@ type (
 		Clock     time.Time `json:"clock"`
 		Reservoir Insulin   `json:"reservoir"`
 		Status    Status    `json:"status"`
+		// Extended holds the AndroidAPS pump.extended data.
+		Extended map[string]interface{} `json:"extended,omitempty"`
+		Extra    Extra                  `json:"-"`
 	}
 
 	// Battery represents the battery data in a Pump record.
 	Battery struct {
 		Voltage Voltage `json:"voltage"`
+		Percent *int    `json:"percent,omitempty"`
+		Extra   Extra   `json:"-"`
 	}
 
 	// Status represents the status data in a Pump record.
@@ -71,6 +170,7 @@ type (
 		Status    string `json:"status"`
 		Bolusing  bool   `json:"bolusing"`
 		Suspended bool   `json:"suspended"`
+		Extra     Extra  `json:"-"`
 	}
 
 	// Uploader represents the uploader data in a DeviceStatus record.
@@ -78,18 +178,35 @@ type (
 		BatteryLevel   int     `json:"battery"`
 		BatteryVoltage Voltage `json:"batteryVoltage,omitempty"`
 		RawBattery     int     `json:"rawBattery,omitempty"`
+		Extra          Extra   `json:"-"`
 	}
 
 	// Treatment represents data for the Nightscout treatments API.
 	Treatment struct {
-		CreatedAt time.Time `json:"created_at"`
-		EventType string    `json:"eventType"`
-		EnteredBy string    `json:"enteredBy,omitempty"`
-		Glucose   *Glucose  `json:"glucose,omitempty"`
-		Absolute  *Insulin  `json:"absolute,omitempty"`
-		Duration  *int      `json:"duration,omitempty"` // minutes
-		Insulin   *Insulin  `json:"insulin,omitempty"`
-		Units     string    `json:"units,omitempty"`
+		ID           string      `json:"_id,omitempty"`
+		CreatedAt    time.Time   `json:"created_at"`
+		EventType    string      `json:"eventType"`
+		EnteredBy    string      `json:"enteredBy,omitempty"`
+		Glucose      *Glucose    `json:"glucose,omitempty"` // mg/dL
+		GlucoseType  string      `json:"glucoseType,omitempty"`
+		Absolute     *Insulin    `json:"absolute,omitempty"`
+		Rate         *Insulin    `json:"rate,omitempty"`
+		Percent      *int        `json:"percent,omitempty"`  // relative to the scheduled basal rate
+		Duration     *int        `json:"duration,omitempty"` // minutes
+		Insulin      *Insulin    `json:"insulin,omitempty"`
+		Carbs        *float64    `json:"carbs,omitempty"`    // grams
+		Protein      *float64    `json:"protein,omitempty"`  // grams
+		Fat          *float64    `json:"fat,omitempty"`      // grams
+		PreBolus     *int        `json:"preBolus,omitempty"` // minutes
+		SplitNow     *int        `json:"splitNow,omitempty"` // percent
+		SplitExt     *int        `json:"splitExt,omitempty"` // percent
+		TargetTop    *float64    `json:"targetTop,omitempty"`
+		TargetBottom *float64    `json:"targetBottom,omitempty"`
+		Reason       string      `json:"reason,omitempty"`
+		Profile      string      `json:"profile,omitempty"`
+		Percentage   *int        `json:"percentage,omitempty"` // of the profile, for profile switches
+		Notes        string      `json:"notes,omitempty"`
+		Units        GlucoseUnit `json:"units,omitempty"`
 	}
 
 	// TreatmentTime is used to unmarshal just the CreatedAt field of a Treatment.
@@ -99,7 +216,7 @@ type (
 
 	// Profile represents data for the Nightscout profile API.
 	Profile struct {
-		ID             string                 `json:"_id"`
+		ID             string                 `json:"_id,omitempty"`
 		CreatedAt      time.Time              `json:"created_at"`
 		StartDate      time.Time              `json:"startDate"`
 		DefaultProfile string                 `json:"defaultProfile"`
@@ -113,23 +230,25 @@ type (
 
 	// ProfileData represents the information in a Profile record.
 	ProfileData struct {
-		DIA        int      `json:"dia"` // hours
-		Basal      Schedule `json:"basal"`
-		CarbRatio  Schedule `json:"carbratio"`
-		Sens       Schedule `json:"sens"`
-		TargetLow  Schedule `json:"target_low"`
-		TargetHigh Schedule `json:"target_high"`
-		TimeZone   string   `json:"timezone"`
-		Units      string   `json:"units"`
+		DIA        int         `json:"dia"` // hours
+		Basal      Schedule    `json:"basal"`
+		CarbRatio  Schedule    `json:"carbratio"`
+		Sens       Schedule    `json:"sens"`
+		TargetLow  Schedule    `json:"target_low"`
+		TargetHigh Schedule    `json:"target_high"`
+		TimeZone   string      `json:"timezone"`
+		Units      GlucoseUnit `json:"units"`
 	}
 
 	// Schedule represents a sequence of times and values.
 	Schedule []TimeValue
 
 	// TimeValue represents a value with an associated time.
+	// Use the Offset and Float methods to interpret the Time and Value fields.
 	TimeValue struct {
-		Time  string      `json:"time"`
-		Value interface{} `json:"value"`
+		Time          string      `json:"time"` // "HH:MM"
+		Value         interface{} `json:"value"`
+		TimeAsSeconds interface{} `json:"timeAsSeconds,omitempty"` // number or numeric string
 	}
 
 	// The following types are defined here to avoid
@@ -0,0 +1,141 @@
+package nightscout
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// calibrationWindow is the longest time between a meter reading
+	// and the raw sensor reading it is paired with.
+	calibrationWindow = 5 * time.Minute
+
+	// Below this glucose value, Nightscout ignores the filtered raw value.
+	minFilteredBG = 40
+)
+
+// RawBG computes a glucose value in mg/dL from the raw values of a sensor entry
+// and a calibration entry, using the same formula as the Nightscout rawbg plugin.
+// It returns 0 if the calibration or raw values are missing.
+// If the entry also has filtered and glucose values,
+// the result is adjusted by the ratio between them.
+func RawBG(e Entry, cal Entry) int {
+	if cal.Slope == 0 || cal.Scale == 0 || e.Unfiltered == 0 {
+		return 0
+	}
+	raw := cal.Scale * (float64(e.Unfiltered) - cal.Intercept) / cal.Slope
+	if e.Filtered != 0 && e.SGV >= minFilteredBG {
+		ratio := cal.Scale * (float64(e.Filtered) - cal.Intercept) / cal.Slope / float64(e.SGV)
+		raw /= ratio
+	}
+	return int(math.Round(raw))
+}
+
+// Calibrate returns a copy of the entries in which SGV entries without a glucose value
+// are given one computed by RawBG from their raw values,
+// using the most recent calibration entry at or before each one.
+// The entries must be in reverse chronological order.
+func Calibrate(entries Entries) Entries {
+	v := make(Entries, len(entries))
+	copy(v, entries)
+	var cal *Entry
+	// Process entries in chronological order so the latest calibration is known.
+	for i := len(v) - 1; i >= 0; i-- {
+		e := &v[i]
+		switch {
+		case e.Type == CalType:
+			cal = e
+		case e.Type == SGVType && e.SGV == 0 && cal != nil:
+			bg := RawBG(*e, *cal)
+			if bg > 0 {
+				e.SGV = bg
+			}
+		}
+	}
+	return v
+}
+
+// calibrationPairs holds meter readings and the corresponding raw sensor values.
+type calibrationPairs struct {
+	mbg        []float64
+	unfiltered []float64
+	latest     Entry
+}
+
+func (p calibrationPairs) Len() int {
+	return len(p.mbg)
+}
+
+func (p calibrationPairs) X(i int) float64 {
+	return p.mbg[i]
+}
+
+func (p calibrationPairs) Y(i int) float64 {
+	return p.unfiltered[i]
+}
+
+// NewCalibration derives a calibration entry from the meter (MBG) entries
+// by linear regression of raw sensor values against meter readings.
+// Each meter reading is paired with the closest SGV entry with a raw value
+// within 5 minutes. At least two pairs with different meter readings are needed.
+// The calibration entry is dated at the latest meter reading used.
+// The entries must be in reverse chronological order.
+func NewCalibration(entries Entries) (Entry, error) {
+	var p calibrationPairs
+	for _, m := range entries {
+		if m.Type != MBGType || m.MBG == 0 {
+			continue
+		}
+		raw, ok := closestRaw(entries, m.Time())
+		if !ok {
+			continue
+		}
+		if p.Len() == 0 {
+			p.latest = m
+		}
+		p.mbg = append(p.mbg, float64(m.MBG))
+		p.unfiltered = append(p.unfiltered, float64(raw.Unfiltered))
+	}
+	if p.Len() < 2 {
+		return Entry{}, fmt.Errorf("calibration requires at least 2 meter readings with raw sensor values (found %d)", p.Len())
+	}
+	line, err := FindLine(p)
+	if err != nil {
+		return Entry{}, fmt.Errorf("calibration: %v", err)
+	}
+	if line.Slope <= 0 {
+		return Entry{}, fmt.Errorf("calibration: invalid slope %v", line.Slope)
+	}
+	t := p.latest.Time()
+	return Entry{
+		Type:       CalType,
+		Date:       p.latest.Date,
+		DateString: t.Format(DateStringLayout),
+		Device:     p.latest.Device,
+		Slope:      line.Slope,
+		Intercept:  line.Intercept,
+		Scale:      1,
+	}, nil
+}
+
+// closestRaw returns the SGV entry with a raw value closest to t,
+// if there is one within calibrationWindow.
+func closestRaw(entries Entries, t time.Time) (Entry, bool) {
+	var best Entry
+	found := false
+	var bestDiff time.Duration
+	for _, e := range entries {
+		if e.Type != SGVType || e.Unfiltered == 0 {
+			continue
+		}
+		d := e.Time().Sub(t)
+		if d < 0 {
+			d = -d
+		}
+		if d <= calibrationWindow && (!found || d < bestDiff) {
+			best, bestDiff, found = e, d, true
+		}
+	}
+	return best, found
+}
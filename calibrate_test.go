@@ -0,0 +1,96 @@
+package nightscout
+
+import (
+	"testing"
+	"time"
+)
+
+var testCal = Entry{Type: CalType, Slope: 1000, Intercept: 30000, Scale: 1}
+
+func TestRawBG(t *testing.T) {
+	cases := []struct {
+		e   Entry
+		cal Entry
+		bg  int
+	}{
+		{Entry{Unfiltered: 150000}, testCal, 120},
+		{Entry{Unfiltered: 150000, Filtered: 140000, SGV: 110}, testCal, 120},
+		{Entry{Unfiltered: 150000, Filtered: 135000, SGV: 100}, testCal, 114},
+		// The filtered value is ignored for low glucose values.
+		{Entry{Unfiltered: 150000, Filtered: 135000, SGV: 39}, testCal, 120},
+		{Entry{Unfiltered: 150000}, Entry{Type: CalType, Slope: 500, Intercept: 30000, Scale: 0.5}, 120},
+		{Entry{}, testCal, 0},
+		{Entry{Unfiltered: 150000}, Entry{Type: CalType}, 0},
+	}
+	for _, c := range cases {
+		bg := RawBG(c.e, c.cal)
+		if bg != c.bg {
+			t.Errorf("RawBG(%+v, %+v) == %d, want %d", c.e, c.cal, bg, c.bg)
+		}
+	}
+}
+
+// rawEntries returns SGV entries with only raw values,
+// using the inverse of testCal, most recent first.
+func rawEntries(bgs ...int) Entries {
+	e := sgvEntries(bgs...)
+	for i := range e {
+		e[i].Unfiltered = 1000*e[i].SGV + 30000
+		e[i].SGV = 0
+	}
+	return e
+}
+
+func TestCalibrate(t *testing.T) {
+	e := rawEntries(150, 140, 130, 120, 110)
+	e[0].SGV = 155
+	cal1 := testCal
+	cal1.Date = e[3].Date - 1
+	cal2 := Entry{Type: CalType, Date: e[1].Date - 1, Slope: 1000, Intercept: 40000, Scale: 1}
+	e = append(e[:4], append(Entries{cal1}, e[4:]...)...)
+	e = append(e[:2], append(Entries{cal2}, e[2:]...)...)
+	v := Calibrate(e)
+	want := []int{155, 130, 0, 130, 120, 0, 0}
+	for i, x := range v {
+		if x.SGV != want[i] {
+			t.Errorf("entry %d (%s) has SGV %d, want %d", i, x.Type, x.SGV, want[i])
+		}
+	}
+	if e[1].SGV != 0 {
+		t.Errorf("Calibrate modified its argument")
+	}
+}
+
+func TestNewCalibration(t *testing.T) {
+	e := rawEntries(200, 180, 160, 140, 120, 100)
+	mbg := func(i int, bg int, offset time.Duration) Entry {
+		return Entry{Type: MBGType, Date: e[i].Date + int64(offset/time.Millisecond), MBG: bg, Device: "meter"}
+	}
+	_, err := NewCalibration(e)
+	if err == nil {
+		t.Errorf("NewCalibration without meter readings succeeded")
+	}
+	// A meter reading too far from any sensor reading is ignored.
+	meters := Entries{mbg(0, 200, 10*time.Minute), mbg(1, 180, time.Minute), mbg(4, 120, -2*time.Minute)}
+	all := MergeEntries(e, meters.sorted())
+	cal, err := NewCalibration(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !closeEnough(cal.Slope, 1000) || !closeEnough(cal.Intercept, 30000) || cal.Scale != 1 {
+		t.Errorf("NewCalibration == %+v, want slope 1000 and intercept 30000", cal)
+	}
+	if cal.Date != meters[1].Date || cal.Type != CalType || cal.Device != "meter" {
+		t.Errorf("NewCalibration == %+v, want cal entry at %v", cal, meters[1].Time())
+	}
+	v := Calibrate(MergeEntries(all, Entries{cal}))
+	for _, x := range v {
+		if x.Type == SGVType && x.Time().After(cal.Time()) && x.SGV != 200 {
+			t.Errorf("calibrated SGV == %d, want 200", x.SGV)
+		}
+	}
+	_, err = NewCalibration(MergeEntries(e, Entries{mbg(1, 180, 0), mbg(4, 180, 0)}.sorted()))
+	if err == nil {
+		t.Errorf("NewCalibration with equal meter readings succeeded")
+	}
+}
@@ -0,0 +1,343 @@
+package nightscout
+
+import (
+	"fmt"
+	"time"
+)
+
+// Values for the Treatment EventType field used by the Nightscout care portal.
+const (
+	BGCheckEvent           = "BG Check"
+	SnackBolusEvent        = "Snack Bolus"
+	MealBolusEvent         = "Meal Bolus"
+	CorrectionBolusEvent   = "Correction Bolus"
+	CarbCorrectionEvent    = "Carb Correction"
+	ComboBolusEvent        = "Combo Bolus"
+	AnnouncementEvent      = "Announcement"
+	NoteEvent              = "Note"
+	QuestionEvent          = "Question"
+	ExerciseEvent          = "Exercise"
+	SiteChangeEvent        = "Site Change"
+	SensorStartEvent       = "Sensor Start"
+	SensorChangeEvent      = "Sensor Change"
+	PumpBatteryChangeEvent = "Pump Battery Change"
+	InsulinChangeEvent     = "Insulin Change"
+	TempBasalStartEvent    = "Temp Basal Start"
+	TempBasalEndEvent      = "Temp Basal End"
+	TempBasalEvent         = "Temp Basal"
+	ProfileSwitchEvent     = "Profile Switch"
+	DADAlertEvent          = "D.A.D. Alert"
+	TemporaryTargetEvent   = "Temporary Target"
+	OpenAPSOfflineEvent    = "OpenAPS Offline"
+	BolusWizardEvent       = "Bolus Wizard"
+)
+
+// Values for the Treatment GlucoseType field.
+const (
+	FingerGlucose = "Finger"
+	SensorGlucose = "Sensor"
+	ManualGlucose = "Manual"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func floatPtr(x float64) *float64 {
+	return &x
+}
+
+func insulinPtr(x Insulin) *Insulin {
+	return &x
+}
+
+// NewEvent returns a treatment with the given time and event type and no other data.
+func NewEvent(t time.Time, eventType string) Treatment {
+	return Treatment{
+		CreatedAt: t,
+		EventType: eventType,
+	}
+}
+
+// NewBGCheck returns a BG Check treatment.
+// The glucoseType should be FingerGlucose, SensorGlucose, or ManualGlucose.
+func NewBGCheck(t time.Time, bg Glucose, glucoseType string) Treatment {
+	r := NewEvent(t, BGCheckEvent)
+	r.Glucose = &bg
+	r.GlucoseType = glucoseType
+	r.Units = MgdlUnits
+	return r
+}
+
+// NewSnackBolus returns a Snack Bolus treatment.
+func NewSnackBolus(t time.Time, insulin Insulin, carbs float64) Treatment {
+	r := NewEvent(t, SnackBolusEvent)
+	r.Insulin = insulinPtr(insulin)
+	r.Carbs = floatPtr(carbs)
+	return r
+}
+
+// NewMealBolus returns a Meal Bolus treatment.
+func NewMealBolus(t time.Time, insulin Insulin, carbs float64) Treatment {
+	r := NewEvent(t, MealBolusEvent)
+	r.Insulin = insulinPtr(insulin)
+	r.Carbs = floatPtr(carbs)
+	return r
+}
+
+// NewCorrectionBolus returns a Correction Bolus treatment.
+func NewCorrectionBolus(t time.Time, insulin Insulin) Treatment {
+	r := NewEvent(t, CorrectionBolusEvent)
+	r.Insulin = insulinPtr(insulin)
+	return r
+}
+
+// NewCarbCorrection returns a Carb Correction treatment.
+func NewCarbCorrection(t time.Time, carbs float64) Treatment {
+	r := NewEvent(t, CarbCorrectionEvent)
+	r.Carbs = floatPtr(carbs)
+	return r
+}
+
+// NewComboBolus returns a Combo Bolus treatment,
+// with splitNow percent of the insulin delivered immediately
+// and the remainder extended over the given number of minutes.
+func NewComboBolus(t time.Time, insulin Insulin, splitNow int, duration int) Treatment {
+	r := NewEvent(t, ComboBolusEvent)
+	r.Insulin = insulinPtr(insulin)
+	r.SplitNow = intPtr(splitNow)
+	r.SplitExt = intPtr(100 - splitNow)
+	r.Duration = intPtr(duration)
+	return r
+}
+
+// NewAnnouncement returns an Announcement treatment.
+func NewAnnouncement(t time.Time, notes string) Treatment {
+	r := NewEvent(t, AnnouncementEvent)
+	r.Notes = notes
+	return r
+}
+
+// NewNote returns a Note treatment.
+func NewNote(t time.Time, notes string) Treatment {
+	r := NewEvent(t, NoteEvent)
+	r.Notes = notes
+	return r
+}
+
+// NewQuestion returns a Question treatment.
+func NewQuestion(t time.Time, notes string) Treatment {
+	r := NewEvent(t, QuestionEvent)
+	r.Notes = notes
+	return r
+}
+
+// NewExercise returns an Exercise treatment lasting the given number of minutes.
+func NewExercise(t time.Time, duration int) Treatment {
+	r := NewEvent(t, ExerciseEvent)
+	r.Duration = intPtr(duration)
+	return r
+}
+
+// NewSiteChange returns a Site Change treatment.
+func NewSiteChange(t time.Time) Treatment {
+	return NewEvent(t, SiteChangeEvent)
+}
+
+// NewSensorStart returns a Sensor Start treatment.
+func NewSensorStart(t time.Time) Treatment {
+	return NewEvent(t, SensorStartEvent)
+}
+
+// NewSensorChange returns a Sensor Change treatment.
+func NewSensorChange(t time.Time) Treatment {
+	return NewEvent(t, SensorChangeEvent)
+}
+
+// NewPumpBatteryChange returns a Pump Battery Change treatment.
+func NewPumpBatteryChange(t time.Time) Treatment {
+	return NewEvent(t, PumpBatteryChangeEvent)
+}
+
+// NewInsulinChange returns an Insulin Change treatment.
+func NewInsulinChange(t time.Time) Treatment {
+	return NewEvent(t, InsulinChangeEvent)
+}
+
+// NewDADAlert returns a D.A.D. Alert treatment.
+func NewDADAlert(t time.Time) Treatment {
+	return NewEvent(t, DADAlertEvent)
+}
+
+// NewTempBasal returns a Temp Basal treatment with an absolute rate
+// lasting the given number of minutes.
+func NewTempBasal(t time.Time, rate Insulin, duration int) Treatment {
+	r := NewEvent(t, TempBasalEvent)
+	r.Absolute = insulinPtr(rate)
+	r.Rate = insulinPtr(rate)
+	r.Duration = intPtr(duration)
+	return r
+}
+
+// NewPercentTempBasal returns a Temp Basal treatment with a rate
+// relative to the scheduled basal rate, lasting the given number of minutes.
+func NewPercentTempBasal(t time.Time, percent int, duration int) Treatment {
+	r := NewEvent(t, TempBasalEvent)
+	r.Percent = intPtr(percent)
+	r.Duration = intPtr(duration)
+	return r
+}
+
+// NewTempBasalEnd returns a Temp Basal End treatment.
+func NewTempBasalEnd(t time.Time) Treatment {
+	return NewEvent(t, TempBasalEndEvent)
+}
+
+// NewProfileSwitch returns a Profile Switch treatment.
+// A duration of 0 makes the switch permanent.
+func NewProfileSwitch(t time.Time, profile string, duration int) Treatment {
+	r := NewEvent(t, ProfileSwitchEvent)
+	r.Profile = profile
+	r.Duration = intPtr(duration)
+	return r
+}
+
+// NewTemporaryTarget returns a Temporary Target treatment
+// with targets in mg/dL, lasting the given number of minutes.
+func NewTemporaryTarget(t time.Time, bottom, top float64, duration int, reason string) Treatment {
+	r := NewEvent(t, TemporaryTargetEvent)
+	r.TargetBottom = floatPtr(bottom)
+	r.TargetTop = floatPtr(top)
+	r.Duration = intPtr(duration)
+	r.Reason = reason
+	r.Units = MgdlUnits
+	return r
+}
+
+// NewTemporaryTargetCancel returns a Temporary Target treatment
+// that cancels any active temporary target.
+func NewTemporaryTargetCancel(t time.Time) Treatment {
+	r := NewEvent(t, TemporaryTargetEvent)
+	r.Duration = intPtr(0)
+	return r
+}
+
+// NewOpenAPSOffline returns an OpenAPS Offline treatment
+// lasting the given number of minutes.
+func NewOpenAPSOffline(t time.Time, duration int) Treatment {
+	r := NewEvent(t, OpenAPSOfflineEvent)
+	r.Duration = intPtr(duration)
+	return r
+}
+
+// Validate checks that a treatment has the fields required by its event type.
+// Treatments with other event types are only checked for consistency.
+func (r Treatment) Validate() error {
+	if r.CreatedAt.IsZero() {
+		return fmt.Errorf("treatment has no created_at time")
+	}
+	if len(r.EventType) == 0 {
+		return fmt.Errorf("treatment has no eventType")
+	}
+	err := r.validateValues()
+	if err != nil {
+		return err
+	}
+	switch r.EventType {
+	case BGCheckEvent:
+		return r.require("glucose", r.Glucose != nil)
+	case SnackBolusEvent, MealBolusEvent:
+		return r.require("insulin or carbs", r.Insulin != nil || r.Carbs != nil)
+	case CorrectionBolusEvent:
+		return r.require("insulin", r.Insulin != nil)
+	case CarbCorrectionEvent:
+		return r.require("carbs", r.Carbs != nil)
+	case ComboBolusEvent:
+		err = r.require("insulin, splitNow, splitExt, and duration",
+			r.Insulin != nil && r.SplitNow != nil && r.SplitExt != nil && r.Duration != nil)
+		if err != nil {
+			return err
+		}
+		if *r.SplitNow+*r.SplitExt != 100 {
+			return r.invalid("splitNow + splitExt = %d%%", *r.SplitNow+*r.SplitExt)
+		}
+	case AnnouncementEvent, NoteEvent, QuestionEvent:
+		return r.require("notes", len(r.Notes) != 0)
+	case ExerciseEvent, OpenAPSOfflineEvent:
+		return r.require("duration", r.Duration != nil)
+	case TempBasalEvent:
+		return r.require("duration and rate",
+			r.Duration != nil && (r.Absolute != nil || r.Rate != nil || r.Percent != nil))
+	case ProfileSwitchEvent:
+		return r.require("profile", len(r.Profile) != 0)
+	case TemporaryTargetEvent:
+		err = r.require("duration", r.Duration != nil)
+		if err != nil || *r.Duration == 0 {
+			return err
+		}
+		err = r.require("targetTop and targetBottom", r.TargetTop != nil && r.TargetBottom != nil)
+		if err != nil {
+			return err
+		}
+		if *r.TargetBottom > *r.TargetTop {
+			return r.invalid("targetBottom %v is above targetTop %v", *r.TargetBottom, *r.TargetTop)
+		}
+	}
+	return nil
+}
+
+func (r Treatment) validateValues() error {
+	if r.Glucose != nil && *r.Glucose <= 0 {
+		return r.invalid("glucose %d", *r.Glucose)
+	}
+	if r.Insulin != nil && *r.Insulin < 0 {
+		return r.invalid("insulin %v", *r.Insulin)
+	}
+	if r.Absolute != nil && *r.Absolute < 0 {
+		return r.invalid("absolute rate %v", *r.Absolute)
+	}
+	if r.Rate != nil && *r.Rate < 0 {
+		return r.invalid("rate %v", *r.Rate)
+	}
+	if r.Percent != nil && *r.Percent < -100 {
+		return r.invalid("percent %d", *r.Percent)
+	}
+	if r.Duration != nil && *r.Duration < 0 {
+		return r.invalid("duration %d", *r.Duration)
+	}
+	for _, v := range []struct {
+		name  string
+		value *float64
+	}{
+		{"carbs", r.Carbs},
+		{"protein", r.Protein},
+		{"fat", r.Fat},
+	} {
+		if v.value != nil && *v.value < 0 {
+			return r.invalid("%s %v", v.name, *v.value)
+		}
+	}
+	for _, v := range []struct {
+		name  string
+		value *int
+	}{
+		{"splitNow", r.SplitNow},
+		{"splitExt", r.SplitExt},
+	} {
+		if v.value != nil && (*v.value < 0 || *v.value > 100) {
+			return r.invalid("%s %d%%", v.name, *v.value)
+		}
+	}
+	return nil
+}
+
+func (r Treatment) require(fields string, present bool) error {
+	if present {
+		return nil
+	}
+	return fmt.Errorf("%s treatment requires %s", r.EventType, fields)
+}
+
+func (r Treatment) invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%s treatment has invalid %s", r.EventType, fmt.Sprintf(format, args...))
+}
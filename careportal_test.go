@@ -0,0 +1,89 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	now := parseTime("2018-06-30 12:00")
+	cases := []struct {
+		treatment Treatment
+		valid     bool
+	}{
+		{NewBGCheck(now, 105, FingerGlucose), true},
+		{NewBGCheck(now, 0, FingerGlucose), false},
+		{NewEvent(now, BGCheckEvent), false},
+		{NewSnackBolus(now, 1.5, 20), true},
+		{NewMealBolus(now, 4, 45), true},
+		{NewMealBolus(now, -1, 45), false},
+		{NewEvent(now, MealBolusEvent), false},
+		{NewCorrectionBolus(now, 0.8), true},
+		{NewEvent(now, CorrectionBolusEvent), false},
+		{NewCarbCorrection(now, 15), true},
+		{NewCarbCorrection(now, -15), false},
+		{NewComboBolus(now, 6, 60, 120), true},
+		{NewComboBolus(now, 6, 160, 120), false},
+		{NewAnnouncement(now, "pump site changed"), true},
+		{NewNote(now, ""), false},
+		{NewQuestion(now, "lunch?"), true},
+		{NewExercise(now, 45), true},
+		{NewEvent(now, ExerciseEvent), false},
+		{NewSiteChange(now), true},
+		{NewSensorStart(now), true},
+		{NewSensorChange(now), true},
+		{NewPumpBatteryChange(now), true},
+		{NewInsulinChange(now), true},
+		{NewDADAlert(now), true},
+		{NewTempBasal(now, 1.25, 30), true},
+		{NewTempBasal(now, -1, 30), false},
+		{NewPercentTempBasal(now, -50, 30), true},
+		{NewEvent(now, TempBasalEvent), false},
+		{NewTempBasalEnd(now), true},
+		{NewProfileSwitch(now, "Exercise", 60), true},
+		{NewProfileSwitch(now, "", 60), false},
+		{NewTemporaryTarget(now, 140, 160, 60, "Activity"), true},
+		{NewTemporaryTarget(now, 160, 140, 60, "Activity"), false},
+		{NewTemporaryTargetCancel(now), true},
+		{NewOpenAPSOffline(now, 60), true},
+		{NewEvent(now, "Custom Event"), true},
+		{NewEvent(time.Time{}, NoteEvent), false},
+		{NewEvent(now, ""), false},
+	}
+	for _, c := range cases {
+		t.Run(c.treatment.EventType, func(t *testing.T) {
+			err := c.treatment.Validate()
+			if c.valid && err != nil {
+				t.Errorf("Validate(%+v) returned %v", c.treatment, err)
+			}
+			if !c.valid && err == nil {
+				t.Errorf("Validate(%+v) succeeded", c.treatment)
+			}
+		})
+	}
+}
+
+func TestTreatmentJSON(t *testing.T) {
+	now := parseTime("2018-06-30 12:00").UTC()
+	r := NewTemporaryTarget(now, 140, 160, 60, "Activity")
+	r.ID = "5b37a7d0e1b2c3d4e5f60718"
+	r.Notes = "soccer"
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"_id":"5b37a7d0e1b2c3d4e5f60718","created_at":"2018-06-30T16:00:00Z","eventType":"Temporary Target","duration":60,"targetTop":160,"targetBottom":140,"reason":"Activity","notes":"soccer","units":"mg/dl"}`
+	if string(data) != want {
+		t.Errorf("Marshal(%+v) == %s, want %s", r, data, want)
+	}
+	var u Treatment
+	err = json.Unmarshal(data, &u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(u, r) {
+		t.Errorf("Unmarshal(%s) == %+v, want %+v", data, u, r)
+	}
+}
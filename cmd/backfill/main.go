@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+var (
+	dryRun      = flag.Bool("n", false, "dry run: report gaps but don't upload anything")
+	verbose     = flag.Bool("v", false, "verbose mode")
+	window      = flag.Duration("t", 24*time.Hour, "time window to check for gaps")
+	gapDuration = flag.Duration("g", 7*time.Minute, "minimum duration of a gap")
+	batchSize   = flag.Int("b", 100, "number of entries to upload at a time")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 || *batchSize < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] glucose.json\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	site, err := nightscout.DefaultSite()
+	if err != nil {
+		log.Fatal(err)
+	}
+	site.SetVerbose(*verbose)
+	site.SetNoUpload(*dryRun)
+	since := time.Now().Add(-*window)
+	gaps, err := site.Gaps(since, *gapDuration)
+	if err != nil {
+		log.Fatal(err)
+	}
+	missing, err := readMissing(flag.Arg(0), gaps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i := 0; i < len(missing); i += *batchSize {
+		j := i + *batchSize
+		if j > len(missing) {
+			j = len(missing)
+		}
+		err = site.UploadEntries(missing[i:j])
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	report(gaps, missing)
+}
+
+// readMissing reads the entries in file that fall within the gaps,
+// without keeping the rest in memory.
+func readMissing(file string, gaps []nightscout.Gap) (nightscout.Entries, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := nightscout.NewEntryReader(f)
+	var missing nightscout.Entries
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := e.Time()
+		for _, g := range gaps {
+			if g.Includes(t) {
+				missing = append(missing, e)
+				break
+			}
+		}
+	}
+	missing.Sort()
+	return missing, nil
+}
+
+// report prints each gap and the number of entries used to fill it.
+func report(gaps []nightscout.Gap, missing nightscout.Entries) {
+	verb := "uploaded"
+	if *dryRun {
+		verb = "would upload"
+	}
+	i := 0
+	for _, g := range gaps {
+		n := 0
+		for i < len(missing) && !missing[i].Time().Before(g.Start) {
+			n++
+			i++
+		}
+		fmt.Printf("%s – %s  %8v  %s %d entries\n",
+			g.Start.Format(time.Stamp), g.Finish.Format(time.Stamp),
+			g.Finish.Sub(g.Start).Round(time.Minute), verb, n)
+	}
+	fmt.Printf("%d gaps found, %s %d entries\n", len(gaps), verb, len(missing))
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ecc1/nightscout"
@@ -12,6 +15,7 @@ import (
 
 var (
 	verbose = flag.Bool("v", false, "verbose mode")
+	presets = flag.String("p", "default", "comma-separated list of trend presets to compare, or \"all\"")
 )
 
 func main() {
@@ -21,24 +25,126 @@ func main() {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
-	entries, err := nightscout.ReadEntriesFile(flag.Arg(0))
+	names := presetNames()
+	classifiers := make([]nightscout.TrendClassifier, len(names))
+	for i, name := range names {
+		c, ok := nightscout.TrendPresets[name]
+		if !ok {
+			log.Fatalf("unknown trend preset %q", name)
+		}
+		classifiers[i] = c
+	}
+	f, err := os.Open(flag.Arg(0))
 	if err != nil {
 		log.Fatal(err)
 	}
-	total := 0
-	wrong := 0
-	for i, e := range entries {
-		if e.Type != nightscout.SGVType {
-			continue
+	defer f.Close()
+	if *verbose {
+		fmt.Printf("%-15s  %-13s", "", "direction")
+		for _, name := range names {
+			fmt.Printf("  %-13s", name)
+		}
+		fmt.Println()
+	}
+	ck := newChecker(classifiers)
+	// Entries are read in reverse chronological order, so an entry can be checked
+	// once the entries it may depend on have been read.
+	r := nightscout.NewEntryReader(f)
+	var buf nightscout.Entries
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		buf = append(buf, e)
+		for len(buf) != 0 && ck.ready(buf) {
+			ck.check(buf)
+			buf = buf[1:]
+		}
+	}
+	for len(buf) != 0 {
+		ck.check(buf)
+		buf = buf[1:]
+	}
+	if ck.total == 0 {
+		log.Fatal("no sgv entries")
+	}
+	for j, name := range names {
+		fmt.Printf("%-8s %d / %d wrong (%d%% correct)\n", name, ck.wrong[j], ck.total, 100*(ck.total-ck.wrong[j])/ck.total)
+	}
+}
+
+type checker struct {
+	classifiers []nightscout.TrendClassifier
+	lookback    time.Duration // 0 if unlimited
+	total       int
+	wrong       []int
+	trends      []string
+}
+
+func newChecker(classifiers []nightscout.TrendClassifier) *checker {
+	ck := &checker{
+		classifiers: classifiers,
+		wrong:       make([]int, len(classifiers)),
+		trends:      make([]string, len(classifiers)),
+	}
+	for _, c := range classifiers {
+		d := c.Lookback()
+		if d == 0 {
+			ck.lookback = 0
+			break
 		}
-		trend := nightscout.Trend(entries[i:])
-		if trend != e.Direction {
-			wrong++
-			if *verbose {
-				fmt.Printf("%s  %-13s  %-13s\n", e.Time().Format(time.Stamp), trend, e.Direction)
-			}
+		if d > ck.lookback {
+			ck.lookback = d
 		}
-		total++
 	}
-	fmt.Printf("%d / %d wrong (%d%% correct)\n", wrong, total, 100*(total-wrong)/total)
+	return ck
+}
+
+// ready reports whether the first entry in buf can be checked,
+// because the last one is older than any classifier will use.
+func (ck *checker) ready(buf nightscout.Entries) bool {
+	if ck.lookback == 0 {
+		return false
+	}
+	return buf[0].Time().Sub(buf[len(buf)-1].Time()) > ck.lookback
+}
+
+// check compares the trend of the first entry in buf with each classifier's result.
+func (ck *checker) check(buf nightscout.Entries) {
+	e := buf[0]
+	if e.Type != nightscout.SGVType {
+		return
+	}
+	mismatch := false
+	for j, c := range ck.classifiers {
+		ck.trends[j] = c.Trend(buf)
+		if ck.trends[j] != e.Direction {
+			ck.wrong[j]++
+			mismatch = true
+		}
+	}
+	if mismatch && *verbose {
+		fmt.Printf("%s  %-13s", e.Time().Format(time.Stamp), e.Direction)
+		for _, trend := range ck.trends {
+			fmt.Printf("  %-13s", trend)
+		}
+		fmt.Println()
+	}
+	ck.total++
+}
+
+func presetNames() []string {
+	if *presets != "all" {
+		return strings.Split(*presets, ",")
+	}
+	var names []string
+	for name := range nightscout.TrendPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
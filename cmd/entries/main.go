@@ -1,12 +1,19 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 
 	"github.com/ecc1/nightscout"
 )
 
+var (
+	csvFormat = flag.Bool("csv", false, "print entries in CSV format")
+)
+
 func main() {
+	flag.Parse()
 	site, err := nightscout.DefaultSite()
 	if err != nil {
 		log.Fatal(err)
@@ -15,5 +22,12 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *csvFormat {
+		err = entries.WriteCSV(os.Stdout, nightscout.CSVOptions{})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	entries.Print()
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+
+	"github.com/ecc1/nightscout"
+	"github.com/ecc1/nightscout/stats"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	verbose  = flag.Bool("v", false, "verbose mode")
+	days     = flag.Int("d", 14, "number of days to report")
+	endDate  = flag.String("e", "", "last date to report, as YYYY-MM-DD (default today)")
+	binWidth = flag.Duration("b", time.Hour, "width of time-of-day bins for the glucose profile")
+	tight    = flag.Bool("tight", false, "use a target range of 70-140 mg/dL instead of 70-180")
+	file     = flag.String("f", "", "read entries from JSON file instead of downloading them")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 || *days < 1 || *binWidth <= 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	start, end := dateRange()
+	entries, err := getEntries(start, end)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bands := stats.ConsensusBands
+	if *tight {
+		bands = stats.TightBands
+	}
+	s, err := stats.Summarize(entries, bands)
+	if err != nil {
+		log.Fatal(err)
+	}
+	summary(start, end, s)
+	fmt.Println()
+	bins, err := stats.AGP(entries, *binWidth, time.Local)
+	if err != nil {
+		log.Fatal(err)
+	}
+	profile(bins)
+}
+
+// dateRange returns the beginning and end of the days to report.
+func dateRange() (time.Time, time.Time) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if *endDate != "" {
+		var err error
+		end, err = time.ParseInLocation(dateLayout, *endDate, time.Local)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	end = end.AddDate(0, 0, 1)
+	return end.AddDate(0, 0, -*days), end
+}
+
+func getEntries(start, end time.Time) (nightscout.Entries, error) {
+	var entries nightscout.Entries
+	if *file != "" {
+		var err error
+		entries, err = nightscout.ReadEntriesFile(*file)
+		if err != nil {
+			return nil, err
+		}
+		entries.Sort()
+		entries = entries.TrimAfter(start)
+	} else {
+		site, err := nightscout.DefaultSite()
+		if err != nil {
+			return nil, err
+		}
+		site.SetVerbose(*verbose)
+		entries, err = site.EntriesBetween(start, end)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var v nightscout.Entries
+	for _, e := range entries.Filter(nightscout.SGVType) {
+		if e.Time().Before(end) {
+			v = append(v, e)
+		}
+	}
+	return v, nil
+}
+
+func summary(start, end time.Time, s stats.Summary) {
+	fmt.Printf("%s to %s: %d readings\n", start.Format(dateLayout), end.AddDate(0, 0, -1).Format(dateLayout), s.Readings)
+	fmt.Println()
+	for i, b := range s.Bands {
+		fmt.Printf("%-10s %s  %5.1f%%\n", b.Name, bandRange(b), 100*s.TimeInRange[i])
+	}
+	fmt.Println()
+	fmt.Printf("mean       %6.1f mg/dL\n", s.Mean)
+	fmt.Printf("SD         %6.1f mg/dL\n", s.SD)
+	fmt.Printf("CV         %6.1f%%\n", s.CV)
+	fmt.Printf("GMI        %6.1f%%\n", s.GMI)
+	fmt.Printf("eA1c       %6.1f%%\n", s.EA1c)
+	fmt.Printf("MAGE       %6.1f mg/dL\n", s.MAGE)
+	fmt.Printf("MODD       %6.1f mg/dL\n", s.MODD)
+	fmt.Printf("CONGA1     %6.1f mg/dL\n", s.CONGA)
+	fmt.Printf("LBGI       %6.1f\n", s.LBGI)
+	fmt.Printf("HBGI       %6.1f\n", s.HBGI)
+	fmt.Printf("GRI        %6.1f\n", s.GRI)
+}
+
+func bandRange(b stats.Band) string {
+	switch {
+	case b.Low == 0:
+		return fmt.Sprintf("    < %-3d", b.High)
+	case b.High == math.MaxInt32:
+		return fmt.Sprintf("   >= %-3d", b.Low)
+	default:
+		return fmt.Sprintf("%3d - %-3d", b.Low, b.High-1)
+	}
+}
+
+// profile prints the percentiles of the ambulatory glucose profile.
+func profile(bins []stats.AGPBin) {
+	fmt.Printf("%-5s  %5s", "time", "n")
+	for _, p := range stats.AGPPercentiles {
+		fmt.Printf("  %4.0f%%", p)
+	}
+	fmt.Println()
+	for _, b := range bins {
+		t := time.Time{}.Add(b.Start)
+		fmt.Printf("%s  %5d", t.Format("15:04"), b.Count)
+		for _, v := range b.Percentiles {
+			fmt.Printf("  %5.0f", v)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+var (
+	dryRun      = flag.Bool("n", false, "dry run: report differences but don't upload anything")
+	verbose     = flag.Bool("v", false, "verbose mode")
+	twoWay      = flag.Bool("2", false, "two-way mode: also copy records from dest-site to source-site")
+	window      = flag.Duration("t", nightscout.DefaultSyncWindow, "time window to synchronize")
+	gapDuration = flag.Duration("g", nightscout.DefaultSyncGap, "minimum duration of a gap in entries")
+	srcSecret   = flag.String("s", "", "API secret or token for source-site (default $NIGHTSCOUT_API_SECRET)")
+	dstSecret   = flag.String("d", "", "API secret or token for dest-site (default $NIGHTSCOUT_API_SECRET)")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] source-site dest-site\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	src := site(flag.Arg(0), *srcSecret)
+	dst := site(flag.Arg(1), *dstSecret)
+	opts := nightscout.SyncOptions{
+		Since:       time.Now().Add(-*window),
+		GapDuration: *gapDuration,
+	}
+	if *twoWay {
+		opts.Mode = nightscout.TwoWay
+	}
+	r, err := nightscout.Sync(src, dst, opts)
+	report(src, dst, r)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func site(url string, secret string) *nightscout.Website {
+	w, err := nightscout.Site(url)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.Token = secret
+	w.SetVerbose(*verbose)
+	w.SetNoUpload(*dryRun)
+	return w
+}
+
+func report(src, dst *nightscout.Website, r nightscout.SyncReport) {
+	verb := "copied"
+	if *dryRun {
+		verb = "would copy"
+	}
+	counts(verb, src, dst, r.ToDest)
+	if *twoWay {
+		counts(verb, dst, src, r.ToSource)
+	}
+	for _, c := range r.Conflicts {
+		fmt.Printf("conflict: %v\n", c)
+	}
+}
+
+func counts(verb string, from, to *nightscout.Website, c nightscout.SyncCounts) {
+	fmt.Printf("%s %s → %s: %d entries, %d treatments, %d devicestatus, %d profiles\n",
+		verb, from, to, c.Entries, c.Treatments, c.DeviceStatus, c.Profiles)
+}
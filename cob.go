@@ -0,0 +1,99 @@
+package nightscout
+
+import (
+	"fmt"
+	"time"
+)
+
+// CarbModel describes how carbs are absorbed, as in the Nightscout COB plugin:
+// after a delay, carbs are absorbed at a constant rate,
+// and a meal is not absorbed until the previous one has been.
+type CarbModel struct {
+	Delay time.Duration
+	Rate  float64 // grams per hour
+}
+
+// DefaultCarbModel uses the same values as Nightscout.
+var DefaultCarbModel = CarbModel{
+	Delay: 20 * time.Minute,
+	Rate:  30,
+}
+
+// CarbsOnBoard holds the carbs remaining from treatments at a given time.
+type CarbsOnBoard struct {
+	Time time.Time
+	COB  float64 // grams
+	// Activity is the rise in glucose, in the profile's units per minute,
+	// from carbs being absorbed.
+	Activity float64
+}
+
+// COB computes the carbs on board at time t using DefaultCarbModel.
+func (p ProfileData) COB(treatments []Treatment, t time.Time) (CarbsOnBoard, error) {
+	return DefaultCarbModel.COB(p, treatments, t)
+}
+
+// COB computes the carbs on board at time t from carb treatments.
+// The profile's insulin sensitivity and carb ratio give the carb sensitivity factor
+// used to compute the glucose rise.
+// An error is returned if there are carb treatments and the carb sensitivity factor
+// cannot be determined.
+func (m CarbModel) COB(p ProfileData, treatments []Treatment, t time.Time) (CarbsOnBoard, error) {
+	x := CarbsOnBoard{Time: t}
+	var lastDecayed time.Time
+	csf := 0.0
+	checked := false
+	for _, r := range chronological(treatments) {
+		if r.CreatedAt.After(t) {
+			break
+		}
+		if r.Carbs == nil || *r.Carbs <= 0 {
+			continue
+		}
+		if !checked {
+			var err error
+			csf, err = p.CSFAt(t)
+			if err != nil {
+				return CarbsOnBoard{Time: t}, err
+			}
+			checked = true
+		}
+		carbs := *r.Carbs
+		start := r.CreatedAt.Add(m.Delay)
+		if start.Before(lastDecayed) {
+			start = lastDecayed
+		}
+		absorption := time.Duration(carbs / m.Rate * float64(time.Hour))
+		lastDecayed = start.Add(absorption)
+		if !t.Before(lastDecayed) {
+			continue
+		}
+		if t.Before(start) {
+			x.COB += carbs
+			continue
+		}
+		x.COB += carbs * lastDecayed.Sub(t).Seconds() / absorption.Seconds()
+		x.Activity += m.Rate / 60 * csf
+	}
+	return x, nil
+}
+
+// CSFAt returns the carb sensitivity factor at time t:
+// the rise in glucose per gram of carbs, in the profile's units.
+// An error is returned if the carb ratio or sensitivity schedule
+// is empty or invalid, or the carb ratio is not positive.
+func (p ProfileData) CSFAt(t time.Time) (float64, error) {
+	err := p.CarbRatio.check()
+	if err != nil {
+		return 0, fmt.Errorf("carb ratio schedule: %v", err)
+	}
+	err = p.Sens.check()
+	if err != nil {
+		return 0, fmt.Errorf("sensitivity schedule: %v", err)
+	}
+	ratio := p.CarbRatioAt(t)
+	if ratio <= 0 {
+		return 0, fmt.Errorf("invalid carb ratio %v", ratio)
+	}
+	return p.SensAt(t) / ratio, nil
+}
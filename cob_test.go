@@ -0,0 +1,76 @@
+package nightscout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCOB(t *testing.T) {
+	t0 := time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC)
+	treatments := []Treatment{
+		NewCarbCorrection(t0.Add(30*time.Minute), 15),
+		NewMealBolus(t0, 3, 30),
+		NewCorrectionBolus(t0, 1),
+	}
+	cases := []struct {
+		t        time.Duration
+		cob      float64
+		activity float64
+	}{
+		{-time.Minute, 0, 0},
+		{0, 30, 0},
+		// Absorption starts after 20 minutes.
+		{20 * time.Minute, 30, 2.5},
+		{50 * time.Minute, 30, 2.5},
+		{65 * time.Minute, 22.5, 2.5},
+		// The second treatment is absorbed after the first.
+		{80 * time.Minute, 15, 2.5},
+		{95 * time.Minute, 7.5, 2.5},
+		{110 * time.Minute, 0, 0},
+	}
+	for _, c := range cases {
+		x, err := testTherapy.COB(treatments, t0.Add(c.t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !closeEnough(x.COB, c.cob) || !closeEnough(x.Activity, c.activity) {
+			t.Errorf("COB at %v == %v with activity %v, want %v and %v", c.t, x.COB, x.Activity, c.cob, c.activity)
+		}
+	}
+	fast := CarbModel{Delay: 0, Rate: 60}
+	x, err := fast.COB(testTherapy, treatments, t0.Add(15*time.Minute))
+	if err != nil || !closeEnough(x.COB, 15) {
+		t.Errorf("COB with fast absorption == %v, %v, want 15", x.COB, err)
+	}
+	noRatio := testTherapy
+	noRatio.CarbRatio = nil
+	_, err = noRatio.COB(treatments, t0.Add(time.Hour))
+	if err == nil {
+		t.Errorf("COB with no carb ratio succeeded")
+	}
+	// The carb ratio is not needed without carbs.
+	_, err = noRatio.COB(treatments[2:], t0.Add(time.Hour))
+	if err != nil {
+		t.Errorf("COB without carbs returned %v", err)
+	}
+}
+
+func TestCSF(t *testing.T) {
+	t0 := time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC)
+	csf, err := testTherapy.CSFAt(t0)
+	if err != nil || csf != 5 {
+		t.Errorf("CSFAt == %v, %v, want 5", csf, err)
+	}
+	invalid := []ProfileData{
+		{},
+		{CarbRatio: testTherapy.CarbRatio},
+		{CarbRatio: Schedule{{Time: "00:00", Value: 0}}, Sens: testTherapy.Sens},
+		{CarbRatio: Schedule{{Time: "25:00", Value: 10}}, Sens: testTherapy.Sens},
+	}
+	for _, p := range invalid {
+		_, err = p.CSFAt(t0)
+		if err == nil {
+			t.Errorf("CSFAt with carb ratio %v and sensitivity %v succeeded", p.CarbRatio, p.Sens)
+		}
+	}
+}
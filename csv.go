@@ -0,0 +1,319 @@
+package nightscout
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVOptions controls how entries are written to and read from CSV files.
+type CSVOptions struct {
+	// Columns lists the fields in each row, by their JSON names.
+	// If it is empty, DefaultCSVColumns is used.
+	// When reading, the columns in a header row take precedence.
+	Columns []string
+	// Location is the time zone used to format the dateString column
+	// and to interpret times without a zone offset when reading.
+	// If it is nil, time.Local is used.
+	Location *time.Location
+	// NoHeader suppresses the header row when writing.
+	NoHeader bool
+}
+
+var (
+	// DefaultCSVColumns are the columns used when none are specified.
+	DefaultCSVColumns = []string{"date", "dateString", "type", "sgv", "direction", "device", "noise"}
+
+	// RawCSVColumns are the columns holding raw sensor and calibration data.
+	RawCSVColumns = []string{"filtered", "unfiltered", "rssi", "slope", "intercept", "scale", "mbg"}
+
+	// AllCSVColumns are all the columns supported for entries.
+	AllCSVColumns = append(append([]string{}, DefaultCSVColumns...), RawCSVColumns...)
+)
+
+// csvDateLayouts are the formats accepted for the dateString column
+// in addition to DateStringLayout.
+// They have no zone offset, so they are interpreted in the Location option.
+var csvDateLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+}
+
+// csvColumn converts a field of an Entry to and from its CSV representation.
+type csvColumn struct {
+	get func(e Entry, loc *time.Location) string
+	set func(e *Entry, s string, loc *time.Location) error
+}
+
+var csvColumns = map[string]csvColumn{
+	"date": {
+		get: func(e Entry, _ *time.Location) string {
+			if e.Date == 0 {
+				return ""
+			}
+			return strconv.FormatInt(e.Date, 10)
+		},
+		set: func(e *Entry, s string, _ *time.Location) error {
+			if len(s) == 0 {
+				return nil
+			}
+			n, err := strconv.ParseInt(s, 10, 64)
+			e.Date = n
+			return err
+		},
+	},
+	"dateString": {
+		get: func(e Entry, loc *time.Location) string {
+			if e.Date == 0 {
+				return e.DateString
+			}
+			return e.Time().In(loc).Format(DateStringLayout)
+		},
+		set: func(e *Entry, s string, loc *time.Location) error {
+			if len(s) == 0 {
+				return nil
+			}
+			t, err := parseCSVTime(s, loc)
+			if err != nil {
+				return err
+			}
+			e.DateString = t.Format(DateStringLayout)
+			if e.Date == 0 {
+				e.Date = Date(t)
+			}
+			return nil
+		},
+	},
+	"type":       stringColumn(func(e *Entry) *string { return &e.Type }),
+	"device":     stringColumn(func(e *Entry) *string { return &e.Device }),
+	"direction":  stringColumn(func(e *Entry) *string { return &e.Direction }),
+	"sgv":        intColumn(func(e *Entry) *int { return &e.SGV }),
+	"noise":      intColumn(func(e *Entry) *int { return &e.Noise }),
+	"filtered":   intColumn(func(e *Entry) *int { return &e.Filtered }),
+	"unfiltered": intColumn(func(e *Entry) *int { return &e.Unfiltered }),
+	"rssi":       intColumn(func(e *Entry) *int { return &e.RSSI }),
+	"mbg":        intColumn(func(e *Entry) *int { return &e.MBG }),
+	"slope":      floatColumn(func(e *Entry) *float64 { return &e.Slope }),
+	"intercept":  floatColumn(func(e *Entry) *float64 { return &e.Intercept }),
+	"scale":      floatColumn(func(e *Entry) *float64 { return &e.Scale }),
+}
+
+func stringColumn(field func(*Entry) *string) csvColumn {
+	return csvColumn{
+		get: func(e Entry, _ *time.Location) string { return *field(&e) },
+		set: func(e *Entry, s string, _ *time.Location) error {
+			*field(e) = s
+			return nil
+		},
+	}
+}
+
+// Numeric columns, like the date column, write zero values as empty strings,
+// as they are omitted from JSON, and read empty strings as zero.
+
+func intColumn(field func(*Entry) *int) csvColumn {
+	return csvColumn{
+		get: func(e Entry, _ *time.Location) string {
+			n := *field(&e)
+			if n == 0 {
+				return ""
+			}
+			return strconv.Itoa(n)
+		},
+		set: func(e *Entry, s string, _ *time.Location) error {
+			if len(s) == 0 {
+				return nil
+			}
+			n, err := strconv.Atoi(s)
+			*field(e) = n
+			return err
+		},
+	}
+}
+
+func floatColumn(field func(*Entry) *float64) csvColumn {
+	return csvColumn{
+		get: func(e Entry, _ *time.Location) string {
+			x := *field(&e)
+			if x == 0 {
+				return ""
+			}
+			return strconv.FormatFloat(x, 'g', -1, 64)
+		},
+		set: func(e *Entry, s string, _ *time.Location) error {
+			if len(s) == 0 {
+				return nil
+			}
+			x, err := strconv.ParseFloat(s, 64)
+			*field(e) = x
+			return err
+		},
+	}
+}
+
+func parseCSVTime(s string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(DateStringLayout, s)
+	if err == nil {
+		return t, nil
+	}
+	for _, layout := range csvDateLayouts {
+		t, err = time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid dateString %q", s)
+}
+
+// columns returns the canonical names of the columns in the options.
+func (opts CSVOptions) columns() ([]string, error) {
+	names := opts.Columns
+	if len(names) == 0 {
+		names = DefaultCSVColumns
+	}
+	cols := make([]string, len(names))
+	for i, name := range names {
+		col, ok := csvColumnName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		cols[i] = col
+	}
+	return cols, nil
+}
+
+// csvColumnName returns the canonical name of a column, ignoring case
+// and the byte order mark that some spreadsheets write at the start of a file.
+func csvColumnName(name string) (string, bool) {
+	name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	for col := range csvColumns {
+		if strings.EqualFold(name, col) {
+			return col, true
+		}
+	}
+	return "", false
+}
+
+func (opts CSVOptions) location() *time.Location {
+	if opts.Location == nil {
+		return time.Local
+	}
+	return opts.Location
+}
+
+// WriteCSV writes entries in CSV format to an io.Writer.
+func (e Entries) WriteCSV(w io.Writer, opts CSVOptions) error {
+	cols, err := opts.columns()
+	if err != nil {
+		return err
+	}
+	loc := opts.location()
+	cw := csv.NewWriter(w)
+	if !opts.NoHeader {
+		err = cw.Write(cols)
+		if err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(cols))
+	for _, x := range e {
+		for i, col := range cols {
+			row[i] = csvColumns[col].get(x, loc)
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// SaveCSV writes entries in CSV format to a file.
+func (e Entries) SaveCSV(file string, opts CSVOptions) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return e.WriteCSV(f, opts)
+}
+
+// ReadEntriesCSV reads entries in CSV format from an io.Reader.
+// If every field in the first row is a column name, ignoring case,
+// that row is used as a header specifying the columns.
+// Otherwise the columns are taken from the options.
+// Entries with a dateString but no date are given the corresponding date,
+// and entries with a date but no dateString are given the corresponding dateString.
+func ReadEntriesCSV(r io.Reader, opts CSVOptions) (Entries, error) {
+	loc := opts.location()
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var cols []string
+	var entries Entries
+	for n := 1; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		if cols == nil {
+			header, ok := csvHeader(row)
+			if ok {
+				cols = header
+				continue
+			}
+			cols, err = opts.columns()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(row) != len(cols) {
+			return entries, fmt.Errorf("record %d: %d fields, want %d", n, len(row), len(cols))
+		}
+		var x Entry
+		for i, col := range cols {
+			err = csvColumns[col].set(&x, strings.TrimSpace(row[i]), loc)
+			if err != nil {
+				return entries, fmt.Errorf("record %d: %s: %v", n, col, err)
+			}
+		}
+		if len(x.DateString) == 0 && x.Date != 0 {
+			x.DateString = x.Time().In(loc).Format(DateStringLayout)
+		}
+		entries = append(entries, x)
+	}
+}
+
+// csvHeader returns the canonical column names in row
+// if it consists entirely of column names.
+func csvHeader(row []string) ([]string, bool) {
+	cols := make([]string, len(row))
+	for i, name := range row {
+		col, ok := csvColumnName(name)
+		if !ok {
+			return nil, false
+		}
+		cols[i] = col
+	}
+	return cols, true
+}
+
+// ReadEntriesCSVFile reads entries in CSV format from a file.
+func ReadEntriesCSVFile(file string, opts CSVOptions) (Entries, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadEntriesCSV(f, opts)
+}
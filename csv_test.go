@@ -0,0 +1,152 @@
+package nightscout
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var csvEntries = Entries{
+	{Type: SGVType, Date: 1530374400000, DateString: "2018-06-30T16:00:00Z", Device: "share2", SGV: 120, Direction: "Flat", Noise: 1, Filtered: 150000, Unfiltered: 151000, RSSI: 178},
+	{Type: MBGType, Date: 1530374100000, DateString: "2018-06-30T15:55:00Z", Device: "meter", MBG: 115},
+	{Type: CalType, Date: 1530374000000, DateString: "2018-06-30T15:53:20Z", Slope: 842.5, Intercept: 31234.25, Scale: 1},
+}
+
+func TestWriteCSV(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		opts CSVOptions
+		want string
+	}{
+		{CSVOptions{Location: time.UTC}, `date,dateString,type,sgv,direction,device,noise
+1530374400000,2018-06-30T16:00:00Z,sgv,120,Flat,share2,1
+1530374100000,2018-06-30T15:55:00Z,mbg,,,meter,
+1530374000000,2018-06-30T15:53:20Z,cal,,,,
+`},
+		{CSVOptions{Columns: []string{"dateString", "sgv", "mbg"}, Location: london}, `dateString,sgv,mbg
+2018-06-30T17:00:00+01:00,120,
+2018-06-30T16:55:00+01:00,,115
+2018-06-30T16:53:20+01:00,,
+`},
+		{CSVOptions{Columns: []string{"date", "unfiltered", "slope", "intercept"}, NoHeader: true}, `1530374400000,151000,,
+1530374100000,,,
+1530374000000,,842.5,31234.25
+`},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		err := csvEntries.WriteCSV(&buf, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.want {
+			t.Errorf("WriteCSV(%+v) wrote\n%s\nwant\n%s", c.opts, buf.String(), c.want)
+		}
+	}
+	err = csvEntries.WriteCSV(&bytes.Buffer{}, CSVOptions{Columns: []string{"date", "bg"}})
+	if err == nil {
+		t.Errorf("WriteCSV with unknown column succeeded")
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	opts := CSVOptions{Columns: AllCSVColumns, Location: time.UTC}
+	err := csvEntries.WriteCSV(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header determines the columns.
+	entries, err := ReadEntriesCSV(&buf, CSVOptions{Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalEntries(entries, csvEntries) {
+		t.Errorf("ReadEntriesCSV == %+v, want %+v", entries, csvEntries)
+	}
+}
+
+func TestCSVZeroValues(t *testing.T) {
+	zero := Entries{{Type: SGVType, SGV: 100}, {}}
+	var buf bytes.Buffer
+	err := zero.WriteCSV(&buf, CSVOptions{Columns: AllCSVColumns, Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join(AllCSVColumns, ",") + "\n,,sgv,100,,,,,,,,,,\n,,,,,,,,,,,,,\n"
+	if buf.String() != want {
+		t.Errorf("WriteCSV wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+	entries, err := ReadEntriesCSV(&buf, CSVOptions{Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, zero) {
+		t.Errorf("ReadEntriesCSV == %+v, want %+v", entries, zero)
+	}
+}
+
+func TestReadEntriesCSV(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		input string
+		opts  CSVOptions
+		want  Entries
+	}{
+		{"header", "\ufeffDateString, SGV ,Type\n2018-06-30 12:00,120,sgv\n", CSVOptions{Location: ny},
+			Entries{{Type: SGVType, Date: 1530374400000, DateString: "2018-06-30T12:00:00-04:00", SGV: 120}}},
+		{"no header", "1530374400000,120\n", CSVOptions{Columns: []string{"date", "sgv"}, Location: time.UTC},
+			Entries{{Date: 1530374400000, DateString: "2018-06-30T16:00:00Z", SGV: 120}}},
+		{"zone offset", "dateString,sgv\n2018-06-30T16:00:00.000Z,120\n", CSVOptions{Location: ny},
+			Entries{{Date: 1530374400000, DateString: "2018-06-30T16:00:00Z", SGV: 120}}},
+		{"date takes precedence", "date,dateString\n1530374400000,2018-06-30T12:00:00Z\n", CSVOptions{Location: time.UTC},
+			Entries{{Date: 1530374400000, DateString: "2018-06-30T12:00:00Z"}}},
+		{"empty fields", "date,sgv,mbg,slope\n1530374400000,,115,\n", CSVOptions{Location: time.UTC},
+			Entries{{Date: 1530374400000, DateString: "2018-06-30T16:00:00Z", MBG: 115}}},
+		{"empty", "", CSVOptions{}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			entries, err := ReadEntriesCSV(strings.NewReader(c.input), c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalEntries(entries, c.want) {
+				t.Errorf("ReadEntriesCSV == %+v, want %+v", entries, c.want)
+			}
+		})
+	}
+}
+
+func TestReadEntriesCSVErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		opts  CSVOptions
+	}{
+		{"bad number", "date,sgv\n1530374400000,high\n", CSVOptions{}},
+		{"bad date", "dateString,sgv\nyesterday,120\n", CSVOptions{}},
+		{"wrong field count", "date,sgv\n1530374400000,120,Flat\n", CSVOptions{}},
+		// Without a header, the first row is parsed as data.
+		{"unknown header", "date,bg\n1530374400000,120\n", CSVOptions{Columns: []string{"date", "sgv"}}},
+		{"unknown column", "1530374400000,120\n", CSVOptions{Columns: []string{"date", "bg"}}},
+		{"bad quoting", "date,type\n1530374400000,\"sgv\n", CSVOptions{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ReadEntriesCSV(strings.NewReader(c.input), c.opts)
+			if err == nil {
+				t.Errorf("ReadEntriesCSV(%q) succeeded", c.input)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package nightscout
+
+import (
+	"context"
+	"time"
+)
+
+// UploadDeviceStatus uploads a devicestatus record to Nightscout.
+func (w Website) UploadDeviceStatus(status DeviceStatus) error {
+	return w.UploadDeviceStatusContext(context.Background(), status)
+}
+
+// UploadDeviceStatusContext uploads a devicestatus record to Nightscout
+// using the given context.
+func (w Website) UploadDeviceStatusContext(ctx context.Context, status DeviceStatus) error {
+	return w.UploadContext(ctx, "api/v1/devicestatus", status)
+}
+
+// DownloadDeviceStatus downloads the n most recent devicestatus records from Nightscout.
+func (w Website) DownloadDeviceStatus(n int) ([]DeviceStatus, error) {
+	return w.DownloadDeviceStatusContext(context.Background(), n)
+}
+
+// DownloadDeviceStatusContext downloads the n most recent devicestatus records from Nightscout
+// using the given context.
+func (w Website) DownloadDeviceStatusContext(ctx context.Context, n int) ([]DeviceStatus, error) {
+	return w.QueryDeviceStatusContext(ctx, NewQuery().Count(n))
+}
+
+// QueryDeviceStatus downloads the devicestatus records matching the given query from Nightscout.
+func (w Website) QueryDeviceStatus(q *Query) ([]DeviceStatus, error) {
+	return w.QueryDeviceStatusContext(context.Background(), q)
+}
+
+// QueryDeviceStatusContext downloads the devicestatus records matching the given query from Nightscout
+// using the given context.
+func (w Website) QueryDeviceStatusContext(ctx context.Context, q *Query) ([]DeviceStatus, error) {
+	var status []DeviceStatus
+	err := w.GetContext(ctx, queryAPI("api/v1/devicestatus", q), &status)
+	return status, err
+}
+
+// DeviceStatusBetween downloads the devicestatus records from start to end, inclusive,
+// most recent first.
+// Records are downloaded in pages of PageSize records.
+func (w Website) DeviceStatusBetween(start, end time.Time) ([]DeviceStatus, error) {
+	return w.DeviceStatusBetweenContext(context.Background(), start, end)
+}
+
+// DeviceStatusBetweenContext downloads the devicestatus records from start to end, inclusive,
+// most recent first, using the given context.
+func (w Website) DeviceStatusBetweenContext(ctx context.Context, start, end time.Time) ([]DeviceStatus, error) {
+	var result []DeviceStatus
+	seen := make(map[string]bool)
+	err := w.walkCreated(start, end, func(q *Query) ([]time.Time, error) {
+		page, err := w.QueryDeviceStatusContext(ctx, q)
+		times := make([]time.Time, len(page))
+		for i, r := range page {
+			times[i] = r.CreatedAt
+			k := deviceStatusKey(r)
+			if seen[k] || r.CreatedAt.Before(start) || r.CreatedAt.After(end) {
+				continue
+			}
+			seen[k] = true
+			result = append(result, r)
+		}
+		return times, err
+	})
+	return result, err
+}
@@ -0,0 +1,167 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const (
+	openapsStatus = `{
+  "created_at": "2018-06-30T16:00:00Z",
+  "device": "openaps://edison",
+  "openaps": {
+    "iob": {"iob": 1.25, "basaliob": 0.5, "bolusiob": 0.75, "activity": 0.01, "time": "2018-06-30T16:00:00Z", "lastBolusTime": 1530374000000},
+    "suggested": {
+      "temp": "absolute", "bg": 120, "tick": "+3", "eventualBG": 150, "targetBG": 100,
+      "insulinReq": 0.4, "sensitivityRatio": 1.1, "COB": 20, "IOB": 1.25,
+      "reason": "COB: 20, Dev: 15, BGI: -2",
+      "predBGs": {"IOB": [120, 122, 124], "ZT": [120, 118], "COB": [120, 125, 130], "UAM": [120, 123], "aCOB": [120, 121]},
+      "deliverAt": "2018-06-30T16:00:05Z", "timestamp": "2018-06-30T16:00:05Z",
+      "duration": 30, "rate": 1.5, "units": 0.3
+    },
+    "enacted": {"rate": 1.5, "duration": 30, "received": true, "recieved": true, "timestamp": "2018-06-30T16:00:10Z", "reason": "ok"},
+    "version": "0.7.0"
+  },
+  "pump": {"battery": {"voltage": 1.45}, "clock": "2018-06-30T12:00:00-04:00", "reservoir": 120.5, "status": {"status": "normal", "bolusing": false, "suspended": false}},
+  "uploader": {"battery": 85, "batteryVoltage": 3.9},
+  "mmtune": {"scanDetails": [["916.55", 5, -60]]}
+}`
+
+	loopStatus = `{
+  "created_at": "2018-06-30T16:00:00Z",
+  "device": "loop://iPhone",
+  "loop": {
+    "name": "Loop", "version": "2.2", "timestamp": "2018-06-30T16:00:00Z",
+    "iob": {"iob": 2.5, "timestamp": "2018-06-30T16:00:00Z", "basalIOB": 1.1},
+    "cob": {"cob": 31.5, "timestamp": "2018-06-30T16:00:00Z", "absorbed": 8.5},
+    "predicted": {"startDate": "2018-06-30T16:00:00Z", "values": [110, 112, 115], "interval": 300},
+    "enacted": {"rate": 0.8, "duration": 30, "timestamp": "2018-06-30T16:00:00Z", "received": true, "bolusVolume": 0.2, "reason": "tempBasal"},
+    "recommendedBolus": 0.5,
+    "recommendedTempBasal": {"rate": 0.8, "duration": 30}
+  },
+  "override": {"active": false}
+}`
+
+	aapsStatus = `{
+  "created_at": "2018-06-30T16:00:00Z",
+  "device": "openaps://samsung",
+  "pump": {
+    "battery": {"percent": 75}, "clock": "2018-06-30T16:00:00Z", "reservoir": 50,
+    "status": {"status": "normal", "timestamp": "2018-06-30T16:00:00Z"},
+    "extended": {"Version": "2.8", "ActiveProfile": "Default", "BaseBasalRate": 0.9, "TempBasalAbsoluteRate": 1.2}
+  }
+}`
+)
+
+func TestDeviceStatusDecode(t *testing.T) {
+	var s DeviceStatus
+	err := json.Unmarshal([]byte(openapsStatus), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sug := s.Openaps.Suggested
+	if sug == nil || sug.EventualBG != 150 || *sug.COB != 20 || sug.Tick != "+3" || len(sug.PredBGs.UAM) != 2 {
+		t.Errorf("Openaps.Suggested == %+v", sug)
+	}
+	if s.Openaps.Enacted == nil || !*s.Openaps.Enacted.Received || s.Openaps.Enacted.Reason != "ok" {
+		t.Errorf("Openaps.Enacted == %+v", s.Openaps.Enacted)
+	}
+	if *s.Openaps.IOB.BasalIOB != 0.5 {
+		t.Errorf("Openaps.IOB == %+v", s.Openaps.IOB)
+	}
+	if _, ok := s.Extra["mmtune"]; !ok || len(s.Extra) != 1 {
+		t.Errorf("Extra == %v", s.Extra)
+	}
+	if _, ok := s.Openaps.Enacted.Extra["recieved"]; !ok {
+		t.Errorf("Openaps.Enacted.Extra == %v", s.Openaps.Enacted.Extra)
+	}
+
+	err = json.Unmarshal([]byte(loopStatus), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := s.Loop
+	if l == nil || l.COB.COB != 31.5 || len(l.Predicted.Values) != 3 || *l.Enacted.BolusVolume != 0.2 {
+		t.Errorf("Loop == %+v", l)
+	}
+
+	err = json.Unmarshal([]byte(aapsStatus), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Pump.Extended["ActiveProfile"] != "Default" || *s.Pump.Battery.Percent != 75 {
+		t.Errorf("Pump == %+v", s.Pump)
+	}
+}
+
+func TestDeviceStatusRoundTrip(t *testing.T) {
+	for _, orig := range []string{openapsStatus, loopStatus, aapsStatus} {
+		t.Run("", func(t *testing.T) {
+			var s DeviceStatus
+			err := json.Unmarshal([]byte(orig), &s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want, have interface{}
+			_ = json.Unmarshal([]byte(orig), &want)
+			err = json.Unmarshal(data, &have)
+			if err != nil {
+				t.Fatalf("%v: %s", err, data)
+			}
+			if !containsJSON(have, want) {
+				t.Errorf("Marshal returned %s, want %s", data, orig)
+			}
+		})
+	}
+}
+
+// containsJSON reports whether every field in want is present in have with the same value.
+func containsJSON(have, want interface{}) bool {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		h, ok := have.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !containsJSON(h[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		h, ok := have.([]interface{})
+		if !ok || len(h) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !containsJSON(h[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(have, want)
+	}
+}
+
+func TestDeviceStatusOmitEmpty(t *testing.T) {
+	s := DeviceStatus{
+		CreatedAt: parseTime("2018-06-30 12:00").UTC(),
+		Device:    "loop://iPhone",
+		Loop:      &Loop{Name: "Loop"},
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"created_at":"2018-06-30T16:00:00Z","device":"loop://iPhone","loop":{"name":"Loop"}}`
+	if string(data) != want {
+		t.Errorf("Marshal(%+v) == %s, want %s", s, data, want)
+	}
+}
@@ -1,12 +1,12 @@
 package nightscout
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/url"
 	"os"
 	"sort"
-	"strconv"
 	"time"
 )
 
@@ -125,10 +125,114 @@ func ReadEntriesFile(file string) (Entries, error) {
 
 // DownloadEntries downloads the n most recent entries from Nightscout.
 func (w Website) DownloadEntries(n int) (Entries, error) {
-	params := url.Values{}
-	params.Add("count", strconv.Itoa(n))
-	rest := "api/v1/entries?" + params.Encode()
+	return w.DownloadEntriesContext(context.Background(), n)
+}
+
+// DownloadEntriesContext downloads the n most recent entries from Nightscout
+// using the given context.
+func (w Website) DownloadEntriesContext(ctx context.Context, n int) (Entries, error) {
+	return w.QueryEntriesContext(ctx, NewQuery().Count(n))
+}
+
+// UploadEntries uploads entries to Nightscout.
+func (w Website) UploadEntries(entries Entries) error {
+	return w.UploadEntriesContext(context.Background(), entries)
+}
+
+// UploadEntriesContext uploads entries to Nightscout
+// using the given context.
+func (w Website) UploadEntriesContext(ctx context.Context, entries Entries) error {
+	return w.UploadContext(ctx, "api/v1/entries", entries)
+}
+
+// QueryEntries downloads the entries matching the given query from Nightscout.
+func (w Website) QueryEntries(q *Query) (Entries, error) {
+	return w.QueryEntriesContext(context.Background(), q)
+}
+
+// QueryEntriesContext downloads the entries matching the given query from Nightscout
+// using the given context.
+func (w Website) QueryEntriesContext(ctx context.Context, q *Query) (Entries, error) {
+	var entries Entries
+	err := w.GetContext(ctx, queryAPI("api/v1/entries", q), &entries)
+	return entries, err
+}
+
+// DownloadSGVs downloads the n most recent sensor glucose entries from Nightscout.
+func (w Website) DownloadSGVs(n int) (Entries, error) {
+	return w.DownloadEntryTypesContext(context.Background(), n, SGVType)
+}
+
+// DownloadSGVsContext downloads the n most recent sensor glucose entries from Nightscout
+// using the given context.
+func (w Website) DownloadSGVsContext(ctx context.Context, n int) (Entries, error) {
+	return w.DownloadEntryTypesContext(ctx, n, SGVType)
+}
+
+// DownloadMBGs downloads the n most recent meter glucose entries from Nightscout.
+func (w Website) DownloadMBGs(n int) (Entries, error) {
+	return w.DownloadEntryTypesContext(context.Background(), n, MBGType)
+}
+
+// DownloadMBGsContext downloads the n most recent meter glucose entries from Nightscout
+// using the given context.
+func (w Website) DownloadMBGsContext(ctx context.Context, n int) (Entries, error) {
+	return w.DownloadEntryTypesContext(ctx, n, MBGType)
+}
+
+// DownloadCals downloads the n most recent calibration entries from Nightscout.
+func (w Website) DownloadCals(n int) (Entries, error) {
+	return w.DownloadEntryTypesContext(context.Background(), n, CalType)
+}
+
+// DownloadCalsContext downloads the n most recent calibration entries from Nightscout
+// using the given context.
+func (w Website) DownloadCalsContext(ctx context.Context, n int) (Entries, error) {
+	return w.DownloadEntryTypesContext(ctx, n, CalType)
+}
+
+// DownloadEntryTypes downloads the n most recent entries of the given types from Nightscout.
+// If no types are given, entries of all types are downloaded.
+func (w Website) DownloadEntryTypes(n int, types ...string) (Entries, error) {
+	return w.DownloadEntryTypesContext(context.Background(), n, types...)
+}
+
+// DownloadEntryTypesContext downloads the n most recent entries of the given types from Nightscout
+// using the given context.
+// If no types are given, entries of all types are downloaded.
+func (w Website) DownloadEntryTypesContext(ctx context.Context, n int, types ...string) (Entries, error) {
+	q := NewQuery().Count(n)
+	var api string
+	switch len(types) {
+	case 0:
+		api = "api/v1/entries"
+	case 1:
+		// Nightscout provides an endpoint for each type.
+		api = "api/v1/entries/" + url.PathEscape(types[0]) + ".json"
+	default:
+		api = "api/v1/entries"
+		values := make([]interface{}, len(types))
+		for i, t := range types {
+			values[i] = t
+		}
+		q.In("type", values...)
+	}
 	var entries Entries
-	err := w.Get(rest, &entries)
+	err := w.GetContext(ctx, queryAPI(api, q), &entries)
 	return entries, err
 }
+
+// Filter returns the entries whose type is one of the given types,
+// in their original order.
+func (e Entries) Filter(types ...string) Entries {
+	var v Entries
+	for _, x := range e {
+		for _, t := range types {
+			if x.Type == t {
+				v = append(v, x)
+				break
+			}
+		}
+	}
+	return v
+}
@@ -3,6 +3,8 @@ package nightscout
 import (
 	"bytes"
 	"fmt"
+	"net/http"
+	"net/url"
 	"reflect"
 	"testing"
 	"time"
@@ -137,3 +139,65 @@ func TestMergeEntries(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterEntries(t *testing.T) {
+	mixed := make(Entries, len(E))
+	copy(mixed, E)
+	for i := range mixed {
+		switch i % 3 {
+		case 0:
+			mixed[i].Type = SGVType
+		case 1:
+			mixed[i].Type = MBGType
+		case 2:
+			mixed[i].Type = CalType
+		}
+	}
+	cases := []struct {
+		types []string
+		want  int
+	}{
+		{nil, 0},
+		{[]string{SGVType}, (len(E) + 2) / 3},
+		{[]string{MBGType, CalType}, len(E) - (len(E)+2)/3},
+		{[]string{SGVType, MBGType, CalType}, len(E)},
+	}
+	for _, c := range cases {
+		v := mixed.Filter(c.types...)
+		if len(v) != c.want {
+			t.Errorf("Filter(%v) returned %d entries, want %d", c.types, len(v), c.want)
+		}
+		for i := 1; i < len(v); i++ {
+			if !v[i-1].After(v[i]) {
+				t.Errorf("Filter(%v) did not preserve order: %v", c.types, v)
+				break
+			}
+		}
+	}
+}
+
+func TestDownloadEntryTypes(t *testing.T) {
+	cases := []struct {
+		types []string
+		want  string
+	}{
+		{nil, "/api/v1/entries?count=5"},
+		{[]string{MBGType}, "/api/v1/entries/mbg.json?count=5"},
+		{[]string{SGVType, CalType}, "/api/v1/entries?count=5&find[type][$in][]=sgv&find[type][$in][]=cal"},
+	}
+	for _, c := range cases {
+		var got string
+		w, cleanup := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+			got, _ = url.PathUnescape(r.URL.RequestURI())
+			_, _ = rw.Write([]byte("[]"))
+		})
+		_, err := w.DownloadEntryTypes(5, c.types...)
+		cleanup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("DownloadEntryTypes(5, %v) requested %s, want %s", c.types, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIError represents an unsuccessful response from a Nightscout API.
+type APIError struct {
+	Method     string
+	URL        string // with any secret redacted
+	StatusCode int
+	// The following fields are decoded from the Nightscout error body, if present.
+	Message     string
+	Description string
+}
+
+const (
+	redacted = "REDACTED"
+
+	// Limit the amount of an error response that will be read.
+	maxErrorBody = 64 * 1024
+)
+
+func (e *APIError) Error() string {
+	s := fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if len(e.Message) != 0 {
+		s += ": " + e.Message
+	}
+	if len(e.Description) != 0 {
+		s += " (" + e.Description + ")"
+	}
+	return s
+}
+
+// newAPIError creates an APIError from an unsuccessful response.
+func newAPIError(resp *http.Response) *APIError {
+	e := &APIError{
+		Method:     resp.Request.Method,
+		URL:        redactURL(resp.Request.URL),
+		StatusCode: resp.StatusCode,
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil || len(body) == 0 {
+		return e
+	}
+	var v struct {
+		Message     string `json:"message"`
+		Description string `json:"description"`
+	}
+	if json.Unmarshal(body, &v) == nil {
+		e.Message = v.Message
+		e.Description = v.Description
+		return e
+	}
+	e.Message = strings.TrimSpace(string(body))
+	return e
+}
+
+// authorizationPath is followed by the access token in API v3 authorization requests.
+const authorizationPath = "/api/v2/authorization/request/"
+
+// redactURL returns the URL as a string with any secrets replaced.
+func redactURL(u *url.URL) string {
+	r := *u
+	if r.User != nil {
+		if _, ok := r.User.Password(); ok {
+			r.User = url.UserPassword(r.User.Username(), redacted)
+		}
+	}
+	if i := strings.Index(r.Path, authorizationPath); i >= 0 {
+		r.Path = r.Path[:i+len(authorizationPath)] + redacted
+		r.RawPath = ""
+	}
+	q := r.Query()
+	changed := false
+	for _, k := range []string{"token", "secret"} {
+		if _, ok := q[k]; ok {
+			q.Set(k, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		r.RawQuery = q.Encode()
+	}
+	return r.String()
+}
+
+// StatusCode returns the HTTP status code of an APIError,
+// or 0 if err is not an APIError.
+func StatusCode(err error) int {
+	var e *APIError
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsUnauthorized returns true if err is an APIError with status 401.
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden returns true if err is an APIError with status 403.
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+// IsNotFound returns true if err is an APIError with status 404.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
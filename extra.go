@@ -0,0 +1,317 @@
+package nightscout
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// unmarshalExtra decodes data into v, which must be a pointer to a struct
+// whose type has no UnmarshalJSON method, and stores any fields
+// that do not correspond to struct fields in extra.
+func unmarshalExtra(data []byte, v interface{}, extra *Extra) error {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return err
+	}
+	var m map[string]json.RawMessage
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return err
+	}
+	names := fieldNames(reflect.TypeOf(v).Elem())
+	*extra = nil
+	for k, raw := range m {
+		if isField(k, names) {
+			continue
+		}
+		if *extra == nil {
+			*extra = make(Extra)
+		}
+		(*extra)[k] = raw
+	}
+	return nil
+}
+
+// marshalExtra encodes v, which must be a struct whose type has no MarshalJSON method,
+// and adds the fields in extra.
+// Unlike encoding/json, struct-valued fields tagged with omitempty
+// are omitted if they have the zero value.
+func marshalExtra(v interface{}, extra Extra) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	sep := func() {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+	}
+	val := reflect.ValueOf(v)
+	t := val.Type()
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, omitEmpty, ok := fieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		names = append(names, name)
+		f := val.Field(i)
+		if omitEmpty && isEmpty(f) {
+			continue
+		}
+		data, err := json.Marshal(f.Interface())
+		if err != nil {
+			return nil, err
+		}
+		sep()
+		writeKey(&buf, name)
+		buf.Write(data)
+	}
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		if !isField(k, names) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sep()
+		writeKey(&buf, k)
+		buf.Write(extra[k])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeKey(buf *bytes.Buffer, key string) {
+	data, _ := json.Marshal(key)
+	buf.Write(data)
+	buf.WriteByte(':')
+}
+
+// isEmpty reports whether a field tagged with omitempty should be omitted.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// fieldNames returns the JSON names of the fields of a struct type.
+func fieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, ok := fieldName(t.Field(i))
+		if ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fieldName returns the JSON name of a struct field
+// and whether it is tagged with omitempty.
+func fieldName(f reflect.StructField) (string, bool, bool) {
+	if f.PkgPath != "" {
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	opts := strings.Split(tag, ",")
+	name := opts[0]
+	if len(name) == 0 {
+		name = f.Name
+	}
+	for _, opt := range opts[1:] {
+		if opt == "omitempty" {
+			return name, true, true
+		}
+	}
+	return name, false, true
+}
+
+// isField reports whether a JSON key matches one of the field names.
+// Like encoding/json, the match is case-insensitive.
+func isField(key string, names []string) bool {
+	for _, name := range names {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// The following methods preserve unknown fields in devicestatus records.
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *DeviceStatus) UnmarshalJSON(data []byte) error {
+	type plain DeviceStatus
+	return unmarshalExtra(data, (*plain)(s), &s.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s DeviceStatus) MarshalJSON() ([]byte, error) {
+	type plain DeviceStatus
+	return marshalExtra(plain(s), s.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (o *Openaps) UnmarshalJSON(data []byte) error {
+	type plain Openaps
+	return unmarshalExtra(data, (*plain)(o), &o.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o Openaps) MarshalJSON() ([]byte, error) {
+	type plain Openaps
+	return marshalExtra(plain(o), o.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (i *IOB) UnmarshalJSON(data []byte) error {
+	type plain IOB
+	return unmarshalExtra(data, (*plain)(i), &i.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (i IOB) MarshalJSON() ([]byte, error) {
+	type plain IOB
+	return marshalExtra(plain(i), i.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Determination) UnmarshalJSON(data []byte) error {
+	type plain Determination
+	return unmarshalExtra(data, (*plain)(d), &d.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Determination) MarshalJSON() ([]byte, error) {
+	type plain Determination
+	return marshalExtra(plain(d), d.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *PredBGs) UnmarshalJSON(data []byte) error {
+	type plain PredBGs
+	return unmarshalExtra(data, (*plain)(p), &p.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p PredBGs) MarshalJSON() ([]byte, error) {
+	type plain PredBGs
+	return marshalExtra(plain(p), p.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *Loop) UnmarshalJSON(data []byte) error {
+	type plain Loop
+	return unmarshalExtra(data, (*plain)(l), &l.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (l Loop) MarshalJSON() ([]byte, error) {
+	type plain Loop
+	return marshalExtra(plain(l), l.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *LoopIOB) UnmarshalJSON(data []byte) error {
+	type plain LoopIOB
+	return unmarshalExtra(data, (*plain)(l), &l.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (l LoopIOB) MarshalJSON() ([]byte, error) {
+	type plain LoopIOB
+	return marshalExtra(plain(l), l.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *LoopCOB) UnmarshalJSON(data []byte) error {
+	type plain LoopCOB
+	return unmarshalExtra(data, (*plain)(l), &l.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (l LoopCOB) MarshalJSON() ([]byte, error) {
+	type plain LoopCOB
+	return marshalExtra(plain(l), l.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *LoopPredicted) UnmarshalJSON(data []byte) error {
+	type plain LoopPredicted
+	return unmarshalExtra(data, (*plain)(l), &l.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (l LoopPredicted) MarshalJSON() ([]byte, error) {
+	type plain LoopPredicted
+	return marshalExtra(plain(l), l.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *LoopEnacted) UnmarshalJSON(data []byte) error {
+	type plain LoopEnacted
+	return unmarshalExtra(data, (*plain)(l), &l.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (l LoopEnacted) MarshalJSON() ([]byte, error) {
+	type plain LoopEnacted
+	return marshalExtra(plain(l), l.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Pump) UnmarshalJSON(data []byte) error {
+	type plain Pump
+	return unmarshalExtra(data, (*plain)(p), &p.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p Pump) MarshalJSON() ([]byte, error) {
+	type plain Pump
+	return marshalExtra(plain(p), p.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (u *Uploader) UnmarshalJSON(data []byte) error {
+	type plain Uploader
+	return unmarshalExtra(data, (*plain)(u), &u.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (u Uploader) MarshalJSON() ([]byte, error) {
+	type plain Uploader
+	return marshalExtra(plain(u), u.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (b *Battery) UnmarshalJSON(data []byte) error {
+	type plain Battery
+	return unmarshalExtra(data, (*plain)(b), &b.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (b Battery) MarshalJSON() ([]byte, error) {
+	type plain Battery
+	return marshalExtra(plain(b), b.Extra)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	type plain Status
+	return unmarshalExtra(data, (*plain)(s), &s.Extra)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s Status) MarshalJSON() ([]byte, error) {
+	type plain Status
+	return marshalExtra(plain(s), s.Extra)
+}
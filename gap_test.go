@@ -134,3 +134,27 @@ func equalEntries(x, y Entries) bool {
 	}
 	return true
 }
+
+func TestGapIncludes(t *testing.T) {
+	g := Gap{Start: T[5], Finish: T[2]}
+	cases := []struct {
+		t        time.Time
+		includes bool
+	}{
+		{T[6], false},
+		{T[5], false},
+		{T[5].Add(time.Second), false},
+		{T[5].Add(2 * time.Second), true},
+		{T[4], true},
+		{T[3], true},
+		{T[2].Add(-2 * time.Second), true},
+		{T[2].Add(-time.Second), false},
+		{T[2], false},
+		{T[1], false},
+	}
+	for _, c := range cases {
+		if g.Includes(c.t) != c.includes {
+			t.Errorf("Includes(%v) == %v, want %v", c.t, !c.includes, c.includes)
+		}
+	}
+}
@@ -1,10 +1,9 @@
 package nightscout
 
 import (
+	"context"
 	"log"
-	"net/url"
 	"sort"
-	"strconv"
 	"time"
 )
 
@@ -16,22 +15,27 @@ type Gap struct {
 
 // Gaps finds gaps in Nightscout entries since the given time that are longer than the specified duration.
 func (w Website) Gaps(since time.Time, gapDuration time.Duration) ([]Gap, error) {
+	return w.GapsContext(context.Background(), since, gapDuration)
+}
+
+// GapsContext finds gaps in Nightscout entries since the given time that are longer than the specified duration,
+// using the given context.
+func (w Website) GapsContext(ctx context.Context, since time.Time, gapDuration time.Duration) ([]Gap, error) {
 	now := time.Now()
 	window := now.Sub(since)
 	log.Printf("retrieving Nightscout records from last %v", window)
-	params := url.Values{}
-	params.Add("find[dateString][$gte]", since.Format(DateStringLayout))
+	q := NewQuery().Gte("dateString", since)
 	// 2 entries per minute should be plenty.
 	numEntries := 2 * int(window/time.Minute)
 	if numEntries > 10 {
-		params.Add("count", strconv.Itoa(numEntries))
+		q.Count(numEntries)
 	}
-	rest := "api/v1/entries?" + params.Encode()
+	rest := queryAPI("api/v1/entries", q)
 	var entries EntryTimes
 	// Suppress verbose output for this.
 	v := w.Verbose()
 	w.SetVerbose(false)
-	err := w.Get(rest, &entries)
+	err := w.GetContext(ctx, rest, &entries)
 	w.SetVerbose(v)
 	if err != nil {
 		return nil, err
@@ -72,6 +76,12 @@ const (
 	edgeMargin = 2 * time.Second
 )
 
+// Includes reports whether t falls within the gap,
+// by a margin of at least 2 seconds to avoid duplicating the entries at its edges.
+func (g Gap) Includes(t time.Time) bool {
+	return t.Sub(g.Start) >= edgeMargin && g.Finish.Sub(t) >= edgeMargin
+}
+
 // Missing returns the Entry values that fall within the given gaps.
 // Entries must be in reverse chronological order.
 func Missing(entries Entries, gaps []Gap) Entries {
@@ -86,15 +96,14 @@ func Missing(entries Entries, gaps []Gap) Entries {
 			}
 			i++
 		}
-		// Add entries that fall within the gap
-		// (by a margin of at least edgeMargin to avoid duplicates).
+		// Add entries that fall within the gap.
 		for i < len(entries) {
 			e := entries[i]
 			t := e.Time()
 			if t.Before(g.Start) {
 				break
 			}
-			if t.Sub(g.Start) >= edgeMargin && g.Finish.Sub(t) >= edgeMargin {
+			if g.Includes(t) {
 				missing = append(missing, e)
 			}
 			i++
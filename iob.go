@@ -0,0 +1,269 @@
+package nightscout
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// InsulinCurve represents the shape of insulin activity over time,
+// as in the oref0 algorithm.
+type InsulinCurve int
+
+// Insulin curves.
+const (
+	// BilinearCurve is the original oref0 model: activity rises linearly
+	// to a peak and then falls linearly, scaled to the duration of insulin action.
+	BilinearCurve InsulinCurve = iota
+	// RapidActingCurve is an exponential model that peaks after 75 minutes,
+	// for insulins such as Humalog and Novolog.
+	RapidActingCurve
+	// UltraRapidCurve is an exponential model that peaks after 55 minutes,
+	// for insulins such as Fiasp.
+	UltraRapidCurve
+)
+
+const (
+	// bilinearPeak is the time of peak activity for a 3-hour bilinear curve.
+	bilinearPeak = 75 * time.Minute
+
+	// basalStep is the interval at which net basal insulin
+	// is treated as a series of small boluses.
+	basalStep = 5 * time.Minute
+)
+
+func (c InsulinCurve) String() string {
+	switch c {
+	case BilinearCurve:
+		return "bilinear"
+	case RapidActingCurve:
+		return "rapid-acting"
+	case UltraRapidCurve:
+		return "ultra-rapid"
+	default:
+		return "unknown"
+	}
+}
+
+// minDIA returns the shortest duration of insulin action that oref0 allows for the curve.
+func (c InsulinCurve) minDIA() time.Duration {
+	if c == BilinearCurve {
+		return 3 * time.Hour
+	}
+	return 5 * time.Hour
+}
+
+// peak returns the time of peak activity of an exponential curve.
+func (c InsulinCurve) peak() time.Duration {
+	if c == UltraRapidCurve {
+		return 55 * time.Minute
+	}
+	return 75 * time.Minute
+}
+
+// Effect returns the fraction of a dose remaining after the elapsed time
+// and the fraction being absorbed per minute at that time,
+// for the given duration of insulin action.
+// The duration is increased to 3 hours for the bilinear curve
+// and 5 hours for the exponential curves if it is shorter.
+func (c InsulinCurve) Effect(elapsed time.Duration, dia time.Duration) (float64, float64) {
+	if dia < c.minDIA() {
+		dia = c.minDIA()
+	}
+	if elapsed < 0 {
+		return 1, 0
+	}
+	if elapsed >= dia {
+		return 0, 0
+	}
+	t := elapsed.Minutes()
+	td := dia.Minutes()
+	if c == BilinearCurve {
+		// The area under the activity curve is 1.
+		tp := bilinearPeak.Minutes() * td / 180
+		h := 2 / td
+		if t < tp {
+			return 1 - h*t*t/(2*tp), h * t / tp
+		}
+		return h * (td - t) * (td - t) / (2 * (td - tp)), h * (td - t) / (td - tp)
+	}
+	tp := c.peak().Minutes()
+	tau := tp * (1 - tp/td) / (1 - 2*tp/td)
+	a := 2 * tau / td
+	s := 1 / (1 - a + (1+a)*math.Exp(-td/tau))
+	activity := s / (tau * tau) * t * (1 - t/td) * math.Exp(-t/tau)
+	remaining := 1 - s*(1-a)*((t*t/(tau*td*(1-a))-t/tau-1)*math.Exp(-t/tau)+1)
+	return remaining, activity
+}
+
+// InsulinOnBoard holds the insulin remaining from treatments at a given time.
+type InsulinOnBoard struct {
+	Time     time.Time
+	IOB      float64 // units
+	BolusIOB float64 // units
+	BasalIOB float64 // units of net basal insulin, which may be negative
+	Activity float64 // units per minute
+}
+
+// dose represents insulin delivered at a given time.
+type dose struct {
+	t     time.Time
+	units float64
+	basal bool
+}
+
+// IOB computes the insulin on board at time t from boluses and temp basals,
+// using the profile's duration of insulin action and basal schedule.
+// Temp basals contribute the difference between their rate and the scheduled rate,
+// and last until their duration expires or the next temp basal starts or ends.
+// An error is returned if there are temp basals
+// and the basal schedule is empty or invalid.
+func (p ProfileData) IOB(treatments []Treatment, t time.Time, curve InsulinCurve) (InsulinOnBoard, error) {
+	doses, err := p.doses(treatments, t)
+	if err != nil {
+		return InsulinOnBoard{Time: t}, err
+	}
+	return p.iob(doses, t, curve), nil
+}
+
+// IOBSeries computes the insulin on board at intervals of the given step
+// from start to end, inclusive.
+func (p ProfileData) IOBSeries(treatments []Treatment, start, end time.Time, step time.Duration, curve InsulinCurve) ([]InsulinOnBoard, error) {
+	doses, err := p.doses(treatments, end)
+	if err != nil {
+		return nil, err
+	}
+	var v []InsulinOnBoard
+	for t := start; !t.After(end); t = t.Add(step) {
+		v = append(v, p.iob(doses, t, curve))
+	}
+	return v, nil
+}
+
+func (p ProfileData) iob(doses []dose, t time.Time, curve InsulinCurve) InsulinOnBoard {
+	dia := time.Duration(p.DIA) * time.Hour
+	x := InsulinOnBoard{Time: t}
+	for _, d := range doses {
+		if d.t.After(t) {
+			continue
+		}
+		remaining, activity := curve.Effect(t.Sub(d.t), dia)
+		if d.basal {
+			x.BasalIOB += d.units * remaining
+		} else {
+			x.BolusIOB += d.units * remaining
+		}
+		x.Activity += d.units * activity
+	}
+	x.IOB = x.BolusIOB + x.BasalIOB
+	return x
+}
+
+// doses returns the insulin delivered by the treatments up to time end.
+// Net basal insulin is divided into doses every basalStep.
+func (p ProfileData) doses(treatments []Treatment, end time.Time) ([]dose, error) {
+	v := chronological(treatments)
+	var doses []dose
+	checked := false
+	for i, r := range v {
+		if r.CreatedAt.After(end) {
+			break
+		}
+		if r.EventType == TempBasalEvent {
+			if !checked {
+				// Otherwise every temp basal would count as extra insulin.
+				err := p.Basal.check()
+				if err != nil {
+					return nil, fmt.Errorf("basal schedule: %v", err)
+				}
+				checked = true
+			}
+			doses = append(doses, p.tempBasalDoses(r, tempBasalEnd(v, i), end)...)
+			continue
+		}
+		if r.Insulin == nil || *r.Insulin <= 0 {
+			continue
+		}
+		units := float64(*r.Insulin)
+		if r.EventType == ComboBolusEvent && r.SplitExt != nil && r.Duration != nil && *r.Duration > 0 {
+			ext := units * float64(*r.SplitExt) / 100
+			units -= ext
+			stop := r.CreatedAt.Add(time.Duration(*r.Duration) * time.Minute)
+			doses = append(doses, spread(r.CreatedAt, stop, end, func(time.Time) float64 {
+				return ext / float64(*r.Duration)
+			}, false)...)
+		}
+		doses = append(doses, dose{t: r.CreatedAt, units: units})
+	}
+	return doses, nil
+}
+
+// chronological returns the treatments sorted in chronological order.
+func chronological(treatments []Treatment) []Treatment {
+	v := make([]Treatment, len(treatments))
+	copy(v, treatments)
+	sort.SliceStable(v, func(i, j int) bool { return v[i].CreatedAt.Before(v[j].CreatedAt) })
+	return v
+}
+
+// tempBasalEnd returns the time that temp basal i in the chronological treatments ends.
+func tempBasalEnd(v []Treatment, i int) time.Time {
+	r := v[i]
+	stop := r.CreatedAt
+	if r.Duration != nil {
+		stop = stop.Add(time.Duration(*r.Duration) * time.Minute)
+	}
+	for _, next := range v[i+1:] {
+		if !next.CreatedAt.Before(stop) {
+			break
+		}
+		if next.EventType == TempBasalEvent || next.EventType == TempBasalEndEvent {
+			return next.CreatedAt
+		}
+	}
+	return stop
+}
+
+// tempBasalDoses returns the net basal insulin delivered by a temp basal.
+func (p ProfileData) tempBasalDoses(r Treatment, stop time.Time, end time.Time) []dose {
+	rate := func(t time.Time) float64 {
+		scheduled := p.BasalAt(t)
+		switch {
+		case r.Absolute != nil:
+			return float64(*r.Absolute) - scheduled
+		case r.Rate != nil:
+			return float64(*r.Rate) - scheduled
+		case r.Percent != nil:
+			// Percent is the change from the scheduled rate.
+			return scheduled * float64(*r.Percent) / 100
+		default:
+			return 0
+		}
+	}
+	return spread(r.CreatedAt, stop, end, func(t time.Time) float64 {
+		return rate(t) / 60
+	}, true)
+}
+
+// spread divides insulin delivered at a rate (in units per minute)
+// from start until stop into doses every basalStep, up to time end.
+// Each dose is placed at the middle of its interval.
+func spread(start, stop, end time.Time, rate func(time.Time) float64, basal bool) []dose {
+	if end.Before(stop) {
+		stop = end
+	}
+	var doses []dose
+	for t := start; t.Before(stop); t = t.Add(basalStep) {
+		next := t.Add(basalStep)
+		if next.After(stop) {
+			next = stop
+		}
+		mid := t.Add(next.Sub(t) / 2)
+		units := rate(mid) * next.Sub(t).Minutes()
+		if units != 0 {
+			doses = append(doses, dose{t: mid, units: units, basal: basal})
+		}
+	}
+	return doses
+}
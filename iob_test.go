@@ -0,0 +1,193 @@
+package nightscout
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var testTherapy = ProfileData{
+	DIA:       5,
+	TimeZone:  "UTC",
+	Basal:     Schedule{{Time: "00:00", Value: 1.2}},
+	CarbRatio: Schedule{{Time: "00:00", Value: 10}},
+	Sens:      Schedule{{Time: "00:00", Value: 50}},
+}
+
+// testIOB computes the insulin on board using testTherapy.
+func testIOB(t *testing.T, treatments []Treatment, at time.Time, curve InsulinCurve) InsulinOnBoard {
+	x, err := testTherapy.IOB(treatments, at, curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+func TestInsulinCurves(t *testing.T) {
+	cases := []struct {
+		curve InsulinCurve
+		dia   time.Duration
+		peak  time.Duration
+	}{
+		{BilinearCurve, 3 * time.Hour, 75 * time.Minute},
+		{BilinearCurve, 4 * time.Hour, 100 * time.Minute},
+		// The duration is at least 3 hours for the bilinear curve.
+		{BilinearCurve, 2 * time.Hour, 75 * time.Minute},
+		{RapidActingCurve, 5 * time.Hour, 75 * time.Minute},
+		{RapidActingCurve, 6 * time.Hour, 75 * time.Minute},
+		{UltraRapidCurve, 5 * time.Hour, 55 * time.Minute},
+		// The duration is at least 5 hours for exponential curves.
+		{UltraRapidCurve, 3 * time.Hour, 55 * time.Minute},
+	}
+	for _, c := range cases {
+		t.Run(c.curve.String(), func(t *testing.T) {
+			r, a := c.curve.Effect(0, c.dia)
+			if r != 1 || a != 0 {
+				t.Errorf("Effect(0) == %v, %v, want 1, 0", r, a)
+			}
+			peak := time.Duration(0)
+			peakActivity := 0.0
+			absorbed := 0.0
+			for m := time.Duration(0); m < 6*time.Hour; m += time.Minute {
+				r, a := c.curve.Effect(m, c.dia)
+				if a > peakActivity {
+					peak, peakActivity = m, a
+				}
+				// Activity is the rate at which the remaining insulin decreases.
+				if math.Abs(1-absorbed-r) > 1e-3 {
+					t.Errorf("Effect(%v) remaining == %v, want %v", m, r, 1-absorbed)
+				}
+				next, _ := c.curve.Effect(m+time.Minute, c.dia)
+				absorbed += 1 - next - (1 - r)
+				if next > r {
+					t.Errorf("remaining insulin increases at %v", m)
+				}
+			}
+			if peak != c.peak {
+				t.Errorf("activity peaks at %v, want %v", peak, c.peak)
+			}
+			r, a = c.curve.Effect(6*time.Hour, c.dia)
+			if r != 0 || a != 0 {
+				t.Errorf("Effect(6h) == %v, %v, want 0, 0", r, a)
+			}
+		})
+	}
+}
+
+func TestBolusIOB(t *testing.T) {
+	t0 := time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC)
+	treatments := []Treatment{
+		NewCorrectionBolus(t0.Add(time.Hour), 1),
+		NewMealBolus(t0, 2, 30),
+		NewNote(t0, "no insulin"),
+	}
+	for _, curve := range []InsulinCurve{BilinearCurve, RapidActingCurve, UltraRapidCurve} {
+		x := testIOB(t, treatments, t0, curve)
+		if x.IOB != 2 || x.BolusIOB != 2 || x.BasalIOB != 0 || x.Activity != 0 {
+			t.Errorf("%v: IOB at bolus == %+v", curve, x)
+		}
+		t1 := t0.Add(2 * time.Hour)
+		r0, a0 := curve.Effect(2*time.Hour, 5*time.Hour)
+		r1, a1 := curve.Effect(time.Hour, 5*time.Hour)
+		x = testIOB(t, treatments, t1, curve)
+		if !closeEnough(x.IOB, 2*r0+r1) || !closeEnough(x.Activity, 2*a0+a1) {
+			t.Errorf("%v: IOB == %+v, want %v and activity %v", curve, x, 2*r0+r1, 2*a0+a1)
+		}
+		// Only the second bolus remains after the duration of insulin action.
+		r1, _ = curve.Effect(4*time.Hour, 5*time.Hour)
+		x = testIOB(t, treatments, t0.Add(5*time.Hour), curve)
+		if !closeEnough(x.IOB, r1) {
+			t.Errorf("%v: IOB after DIA of first bolus == %v, want %v", curve, x.IOB, r1)
+		}
+	}
+}
+
+func TestBasalIOB(t *testing.T) {
+	t0 := time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name       string
+		treatments []Treatment
+		end        time.Time
+		net        float64
+	}{
+		{"zero temp", []Treatment{NewTempBasal(t0, 0, 30)}, t0.Add(30 * time.Minute), -0.6},
+		{"high temp", []Treatment{NewTempBasal(t0, 2.4, 60)}, t0.Add(time.Hour), 1.2},
+		{"percent temp", []Treatment{NewPercentTempBasal(t0, -50, 60)}, t0.Add(time.Hour), -0.6},
+		{"cancelled", []Treatment{NewTempBasal(t0, 0, 30), NewTempBasalEnd(t0.Add(10 * time.Minute))}, t0.Add(10 * time.Minute), -0.2},
+		{"replaced", []Treatment{NewTempBasal(t0, 0, 30), NewTempBasal(t0.Add(20*time.Minute), 1.2, 30)}, t0.Add(20 * time.Minute), -0.4},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// Long after the temp basal, all net insulin has been absorbed.
+			x := testIOB(t, c.treatments, t0.Add(6*time.Hour), BilinearCurve)
+			if x.IOB != 0 {
+				t.Errorf("IOB after DIA == %v", x.IOB)
+			}
+			// Just after the temp basal ends, little of it has been absorbed.
+			x = testIOB(t, c.treatments, c.end, BilinearCurve)
+			if x.BolusIOB != 0 || x.IOB != x.BasalIOB {
+				t.Errorf("IOB == %+v, want only basal IOB", x)
+			}
+			if math.Abs(x.BasalIOB) > math.Abs(c.net) || math.Abs(x.BasalIOB) < 0.9*math.Abs(c.net) || x.BasalIOB*c.net < 0 {
+				t.Errorf("basal IOB == %v, want close to %v", x.BasalIOB, c.net)
+			}
+		})
+	}
+}
+
+func TestComboBolusIOB(t *testing.T) {
+	t0 := time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC)
+	treatments := []Treatment{NewComboBolus(t0, 3, 40, 60)}
+	x := testIOB(t, treatments, t0, RapidActingCurve)
+	if !closeEnough(x.IOB, 1.2) {
+		t.Errorf("IOB at start of combo bolus == %v, want 1.2", x.IOB)
+	}
+	x = testIOB(t, treatments, t0.Add(time.Hour), RapidActingCurve)
+	if x.IOB <= 2.5 || x.IOB >= 3 {
+		t.Errorf("IOB at end of combo bolus == %v, want close to 3", x.IOB)
+	}
+}
+
+func TestIOBSeries(t *testing.T) {
+	t0 := time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC)
+	treatments := []Treatment{NewCorrectionBolus(t0, 1), NewTempBasal(t0, 0, 60)}
+	v, err := testTherapy.IOBSeries(treatments, t0.Add(-time.Hour), t0.Add(5*time.Hour), 5*time.Minute, UltraRapidCurve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 73 {
+		t.Fatalf("IOBSeries returned %d values, want 73", len(v))
+	}
+	for i, x := range v {
+		want := testIOB(t, treatments, x.Time, UltraRapidCurve)
+		if !closeEnough(x.IOB, want.IOB) || !closeEnough(x.Activity, want.Activity) {
+			t.Errorf("IOBSeries[%d] == %+v, want %+v", i, x, want)
+		}
+	}
+	if v[0].IOB != 0 || v[12].IOB != 1 {
+		t.Errorf("IOBSeries == %v, %v at %v, %v", v[0].IOB, v[12].IOB, v[0].Time, v[12].Time)
+	}
+}
+
+func TestIOBInvalidBasal(t *testing.T) {
+	t0 := time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC)
+	temp := []Treatment{NewTempBasal(t0, 0, 30)}
+	bolus := []Treatment{NewCorrectionBolus(t0, 1)}
+	for _, basal := range []Schedule{nil, {{Time: "noon", Value: 1.2}}, {{Time: "00:00", Value: "fast"}}} {
+		p := testTherapy
+		p.Basal = basal
+		_, err := p.IOB(temp, t0.Add(time.Hour), BilinearCurve)
+		if err == nil {
+			t.Errorf("IOB with basal schedule %v succeeded", basal)
+		}
+		_, err = p.IOBSeries(temp, t0, t0.Add(time.Hour), 5*time.Minute, BilinearCurve)
+		if err == nil {
+			t.Errorf("IOBSeries with basal schedule %v succeeded", basal)
+		}
+		// The basal schedule is not needed without temp basals.
+		x, err := p.IOB(bolus, t0, BilinearCurve)
+		if err != nil || x.IOB != 1 {
+			t.Errorf("IOB of bolus with basal schedule %v == %v, %v", basal, x.IOB, err)
+		}
+	}
+}
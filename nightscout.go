@@ -2,6 +2,7 @@ package nightscout
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,6 +20,9 @@ type Website struct {
 	Token    string
 	noUpload bool
 	verbose  bool
+	retry    RetryPolicy
+	pageSize int
+	queue    *UploadQueue
 }
 
 const (
@@ -81,11 +85,11 @@ func (w *Website) SetNoUpload(flag bool) {
 	w.noUpload = flag
 }
 
-func (w *Website) restOperation(op string, api string, data interface{}, result interface{}) error {
+func (w *Website) restOperation(ctx context.Context, op string, api string, data interface{}, result interface{}) error {
 	switch op {
-	case "GET":
+	case "GET", "DELETE":
 		if data != nil {
-			log.Panicf("GET %s operation with data", api)
+			log.Panicf("%s %s operation with data", op, api)
 		}
 	case "POST", "PUT":
 		if data == nil {
@@ -94,32 +98,21 @@ func (w *Website) restOperation(op string, api string, data interface{}, result
 	default:
 		log.Panicf("unsupported %s %s operation", op, api)
 	}
-	req, err := w.makeRequest(op, api, data)
-	if err != nil {
-		return err
-	}
-	if w.verbose || w.noUpload {
-		u := req.URL.String()
-		q, err := url.QueryUnescape(u)
+	if w.noUpload && op != "GET" {
+		req, err := w.makeRequest(ctx, op, api, data)
 		if err != nil {
-			q = u
+			return err
 		}
-		log.Printf("%s %s", op, q)
-		if data != nil {
-			log.Print(JSON(data))
-		}
-	}
-	if w.noUpload && op != "GET" {
+		w.logRequest(req, data)
 		return nil
 	}
-	resp, err := w.Client.Do(req)
+	resp, err := w.do(ctx, op, api, data)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	code := resp.StatusCode
-	if code != http.StatusOK {
-		return fmt.Errorf("%v: %d %s", req.URL, code, http.StatusText(code))
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
 	}
 	if result != nil {
 		err = json.NewDecoder(resp.Body).Decode(result)
@@ -130,7 +123,33 @@ func (w *Website) restOperation(op string, api string, data interface{}, result
 	return err
 }
 
-func (w *Website) makeRequest(op string, api string, data interface{}) (*http.Request, error) {
+// do performs an HTTP request, retrying according to the retry policy.
+func (w *Website) do(ctx context.Context, op string, api string, data interface{}) (*http.Response, error) {
+	return w.retry.do(ctx, w.Client, w.verbose, func(attempt int) (*http.Request, error) {
+		req, err := w.makeRequest(ctx, op, api, data)
+		if err == nil && attempt == 1 {
+			w.logRequest(req, data)
+		}
+		return req, err
+	})
+}
+
+func (w *Website) logRequest(req *http.Request, data interface{}) {
+	if !w.verbose && !w.noUpload {
+		return
+	}
+	u := req.URL.String()
+	q, err := url.QueryUnescape(u)
+	if err != nil {
+		q = u
+	}
+	log.Printf("%s %s", req.Method, q)
+	if data != nil {
+		log.Print(JSON(data))
+	}
+}
+
+func (w *Website) makeRequest(ctx context.Context, op string, api string, data interface{}) (*http.Request, error) {
 	u, err := w.makeURL(op, api)
 	if err != nil {
 		return nil, err
@@ -139,7 +158,7 @@ func (w *Website) makeRequest(op string, api string, data interface{}) (*http.Re
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(op, u, r)
+	req, err := http.NewRequestWithContext(ctx, op, u, r)
 	if err != nil {
 		return nil, err
 	}
@@ -208,17 +227,62 @@ func (w *Website) addHeaders(req *http.Request) error {
 
 // Get performs a GET operation on a Nightscout API.
 func (w *Website) Get(api string, result interface{}) error {
-	return w.restOperation("GET", api, nil, result)
+	return w.GetContext(context.Background(), api, result)
+}
+
+// GetContext performs a GET operation on a Nightscout API
+// using the given context.
+func (w *Website) GetContext(ctx context.Context, api string, result interface{}) error {
+	return w.restOperation(ctx, "GET", api, nil, result)
 }
 
 // Upload performs a POST operation on a Nightscout API.
 func (w *Website) Upload(api string, data interface{}) error {
-	return w.restOperation("POST", api, data, nil)
+	return w.UploadContext(context.Background(), api, data)
+}
+
+// UploadContext performs a POST operation on a Nightscout API
+// using the given context.
+// If the website has an upload queue, pending uploads are performed first,
+// and the data is queued instead if the upload fails with a transient error.
+func (w *Website) UploadContext(ctx context.Context, api string, data interface{}) error {
+	if w.queue == nil || w.noUpload {
+		return w.restOperation(ctx, "POST", api, data, nil)
+	}
+	// Perform pending uploads first to preserve their order.
+	err := w.queue.Flush(ctx, w)
+	if err == nil {
+		err = w.restOperation(ctx, "POST", api, data, nil)
+	}
+	if err != nil && retryLater(err) {
+		if w.verbose {
+			log.Printf("queueing upload to %s: %v", api, err)
+		}
+		return w.queue.Enqueue(api, data)
+	}
+	return err
 }
 
 // Put performs a PUT operation on a Nightscout API.
 func (w *Website) Put(api string, data interface{}) error {
-	return w.restOperation("PUT", api, data, nil)
+	return w.PutContext(context.Background(), api, data)
+}
+
+// PutContext performs a PUT operation on a Nightscout API
+// using the given context.
+func (w *Website) PutContext(ctx context.Context, api string, data interface{}) error {
+	return w.restOperation(ctx, "PUT", api, data, nil)
+}
+
+// Delete performs a DELETE operation on a Nightscout API.
+func (w *Website) Delete(api string) error {
+	return w.DeleteContext(context.Background(), api)
+}
+
+// DeleteContext performs a DELETE operation on a Nightscout API
+// using the given context.
+func (w *Website) DeleteContext(ctx context.Context, api string) error {
+	return w.restOperation(ctx, "DELETE", api, nil, nil)
 }
 
 // Hostname returns the host name.
@@ -0,0 +1,57 @@
+package nightscout
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testSite(t *testing.T, handler http.HandlerFunc) (*Website, func()) {
+	server := httptest.NewServer(handler)
+	w, err := Site(server.URL + "/")
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	w.Token = "test-secret"
+	return w, server.Close
+}
+
+func TestContextCancel(t *testing.T) {
+	done := make(chan struct{})
+	w, cleanup := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+	defer cleanup()
+	defer close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := w.DownloadEntriesContext(ctx, 10)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DownloadEntriesContext returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestContextGet(t *testing.T) {
+	w, cleanup := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-secret") != "test-secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = rw.Write([]byte(`[{"type":"sgv","date":1530374400000,"sgv":100}]`))
+	})
+	defer cleanup()
+	entries, err := w.DownloadEntriesContext(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].SGV != 100 {
+		t.Errorf("DownloadEntriesContext returned %+v", entries)
+	}
+}
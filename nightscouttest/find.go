@@ -0,0 +1,224 @@
+package nightscouttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// condition represents a find[field][$op]=value query parameter.
+type condition struct {
+	field  string
+	op     string
+	values []string
+	// raw specifies that strings are compared as strings, as by MongoDB,
+	// rather than as times.
+	raw bool
+}
+
+// filter represents the find and count parameters of a query.
+type filter struct {
+	conds []condition
+	count int // negative for no limit
+}
+
+var findParam = regexp.MustCompile(`^find\[([^\]]+)\](?:\[(\$[a-z]+)\])?(\[\])?$`)
+
+// parseFilter parses the find[...] and count parameters of a Nightscout query.
+func parseFilter(params url.Values) (filter, error) {
+	f := filter{count: DefaultCount}
+	for k, v := range params {
+		if k == "count" {
+			n, err := strconv.Atoi(v[0])
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid count %q", v[0])
+			}
+			f.count = n
+			continue
+		}
+		m := findParam.FindStringSubmatch(k)
+		if m == nil {
+			continue
+		}
+		op := m[2]
+		if len(op) == 0 {
+			op = "$eq"
+		}
+		switch op {
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$in", "$nin":
+		default:
+			return f, fmt.Errorf("unsupported operator %s in %s", op, k)
+		}
+		f.conds = append(f.conds, condition{field: m[1], op: op, values: v})
+	}
+	return f, nil
+}
+
+// apply returns the records that satisfy the filter, up to its count.
+func (f filter) apply(recs []record) []record {
+	result := []record{}
+	for _, rec := range recs {
+		if f.count >= 0 && len(result) == f.count {
+			break
+		}
+		if f.matches(rec) {
+			result = append(result, rec)
+		}
+	}
+	return result
+}
+
+func (f filter) matches(rec record) bool {
+	for _, c := range f.conds {
+		if !c.matches(lookup(rec, c.field)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) matches(v interface{}) bool {
+	switch c.op {
+	case "$in":
+		return c.any(v)
+	case "$nin":
+		return !c.any(v)
+	case "$ne":
+		return c.compare(v, c.values[0]) != 0
+	}
+	if v == nil {
+		return false
+	}
+	cmp := c.compare(v, c.values[0])
+	switch c.op {
+	case "$eq":
+		return cmp == 0
+	case "$gt":
+		return cmp > 0
+	case "$gte":
+		return cmp >= 0
+	case "$lt":
+		return cmp < 0
+	case "$lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+func (c condition) any(v interface{}) bool {
+	for _, s := range c.values {
+		if v != nil && c.compare(v, s) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (c condition) compare(v interface{}, s string) int {
+	if x, ok := v.(string); ok && c.raw {
+		return strings.Compare(x, s)
+	}
+	return compareValue(v, s)
+}
+
+// lookup returns the value of a possibly dotted field name.
+func lookup(rec record, field string) interface{} {
+	var v interface{} = map[string]interface{}(rec)
+	for _, f := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[f]
+	}
+	return v
+}
+
+// compareValue compares a stored value with a query parameter.
+// Numbers are compared numerically and times chronologically,
+// so that queries work regardless of how times are formatted.
+func compareValue(v interface{}, s string) int {
+	switch x := v.(type) {
+	case json.Number:
+		if y, err := strconv.ParseFloat(s, 64); err == nil {
+			return compareFloats(toFloat(x), y)
+		}
+	case string:
+		return compareStrings(x, s)
+	}
+	return strings.Compare(fmt.Sprint(v), s)
+}
+
+// compareValues compares two stored values, with nil values first.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if x, ok := a.(json.Number); ok {
+		if y, ok := b.(json.Number); ok {
+			return compareFloats(toFloat(x), toFloat(y))
+		}
+	}
+	return compareValue(a, fmt.Sprint(b))
+}
+
+func compareStrings(a, b string) int {
+	s, err1 := parseTime(a)
+	t, err2 := parseTime(b)
+	if err1 == nil && err2 == nil {
+		switch {
+		case s.Before(t):
+			return -1
+		case s.After(t):
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// Time formats used in Nightscout records.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+}
+
+func parseTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range timeLayouts {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func toFloat(v interface{}) float64 {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0
+	}
+	f, _ := n.Float64()
+	return f
+}
@@ -0,0 +1,582 @@
+// Package nightscouttest provides an in-memory Nightscout server for tests.
+//
+// The server implements enough of the Nightscout v1 REST API
+// (entries, treatments, devicestatus, profile, and status.json)
+// and of the xDrip web service (pebble and sgv.json)
+// to exercise the nightscout package without a real website.
+package nightscouttest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+const (
+	// DefaultCount is the number of records returned when a query has no count,
+	// as in Nightscout.
+	DefaultCount = 10
+
+	// DefaultSecret is the API secret used by Site when the server
+	// was created without one.
+	DefaultSecret = "nightscouttest"
+)
+
+// record represents a Nightscout document.
+// Numbers are stored as json.Number values, so they compare exactly.
+type record map[string]interface{}
+
+// collection describes how the records of a Nightscout API are stored.
+type collection struct {
+	sortField string   // records are kept in descending order of this field
+	keyFields []string // fields used to replace duplicate records when uploading
+	records   []record
+}
+
+// fault represents an injected failure.
+type fault struct {
+	remaining int
+	code      int
+}
+
+// Server is an in-memory Nightscout server.
+// Its methods are safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	secret      string
+	hash        string
+	tokens      map[string]bool
+	collections map[string]*collection
+	nextID      int
+	latency     time.Duration
+	stringTimes bool
+	faults      []fault
+	requests    []string
+}
+
+// NewServer starts a new server that requires the given API secret.
+// If secret is empty, requests are not authenticated.
+// The caller should call Close when finished, to shut it down.
+func NewServer(secret string) *Server {
+	s := &Server{
+		secret: secret,
+		tokens: make(map[string]bool),
+		collections: map[string]*collection{
+			"entries":      {sortField: "date", keyFields: []string{"date", "type"}},
+			"treatments":   {sortField: "created_at", keyFields: []string{"created_at", "eventType"}},
+			"devicestatus": {sortField: "created_at"},
+			"profile":      {sortField: "startDate"},
+		},
+	}
+	if len(secret) != 0 {
+		s.hash = sha1Hex(secret)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Site returns a Website that uses the server.
+func (s *Server) Site() *nightscout.Website {
+	w, err := nightscout.Site(s.URL)
+	if err != nil {
+		panic(err)
+	}
+	w.Client = s.Client()
+	w.Token = s.secret
+	if len(w.Token) == 0 {
+		w.Token = DefaultSecret
+	}
+	return w
+}
+
+// Token creates an access token for the given subject, which must be
+// up to ten lowercase letters, digits, or underscores.
+// Use "token=" followed by the result as the Website's API secret.
+func (s *Server) Token(subject string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Nightscout uses the SHA-1 digest of the API secret plus the subject's ObjectID.
+	token := subject + "-" + sha1Hex(s.secret + s.newID())[:16]
+	s.tokens[token] = true
+	return token
+}
+
+// newID returns a new ObjectID-style identifier.
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%024x", s.nextID)
+}
+
+// SetLatency delays each response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetStringTimes makes the server handle created_at fields as Nightscout does
+// with MongoDB: they are stored as strings in UTC with milliseconds
+// and compared as strings in queries.
+// By default, times are compared chronologically regardless of their format.
+func (s *Server) SetStringTimes(flag bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stringTimes = flag
+}
+
+// FailNext makes the next n requests fail with the given HTTP status code.
+// If code is 0, the connection is broken without a valid response instead.
+// Successive calls are applied in order.
+func (s *Server) FailNext(n int, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > 0 {
+		s.faults = append(s.faults, fault{remaining: n, code: code})
+	}
+}
+
+// Requests returns the requests received so far,
+// as the method followed by the request URI.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// AddEntries stores entries as if they had been uploaded.
+func (s *Server) AddEntries(entries nightscout.Entries) {
+	s.add("entries", entries)
+}
+
+// AddTreatments stores treatments as if they had been uploaded.
+func (s *Server) AddTreatments(treatments []nightscout.Treatment) {
+	s.add("treatments", treatments)
+}
+
+// AddDeviceStatus stores devicestatus records as if they had been uploaded.
+func (s *Server) AddDeviceStatus(status []nightscout.DeviceStatus) {
+	s.add("devicestatus", status)
+}
+
+// AddProfile stores a profile record as if it had been uploaded.
+func (s *Server) AddProfile(p nightscout.Profile) {
+	s.add("profile", p)
+}
+
+// Entries returns the stored entries, most recent first.
+func (s *Server) Entries() nightscout.Entries {
+	var v nightscout.Entries
+	s.contents("entries", &v)
+	return v
+}
+
+// Treatments returns the stored treatments, most recent first.
+func (s *Server) Treatments() []nightscout.Treatment {
+	var v []nightscout.Treatment
+	s.contents("treatments", &v)
+	return v
+}
+
+// DeviceStatus returns the stored devicestatus records, most recent first.
+func (s *Server) DeviceStatus() []nightscout.DeviceStatus {
+	var v []nightscout.DeviceStatus
+	s.contents("devicestatus", &v)
+	return v
+}
+
+// Profiles returns the stored profile records, most recent first.
+func (s *Server) Profiles() []nightscout.Profile {
+	var v []nightscout.Profile
+	s.contents("profile", &v)
+	return v
+}
+
+func (s *Server) add(name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	recs, err := decodeRecords(data)
+	if err != nil {
+		panic(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insert(name, recs)
+}
+
+func (s *Server) contents(name string, v interface{}) {
+	s.mu.Lock()
+	data, err := json.Marshal(s.collections[name].records)
+	s.mu.Unlock()
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// decodeRecords decodes a JSON record or array of records.
+func decodeRecords(data []byte) ([]record, error) {
+	data = bytes.TrimSpace(data)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if len(data) != 0 && data[0] == '[' {
+		var recs []record
+		err := dec.Decode(&recs)
+		return recs, err
+	}
+	var rec record
+	err := dec.Decode(&rec)
+	return []record{rec}, err
+}
+
+// insert adds records to a collection, assigning IDs as needed.
+// As in Nightscout, a record with the same key fields as an existing one
+// replaces it.
+func (s *Server) insert(name string, recs []record) []record {
+	c := s.collections[name]
+	for _, rec := range recs {
+		if name == "treatments" && rec["created_at"] == nil {
+			rec["created_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		if s.stringTimes {
+			normalizeCreated(rec)
+		}
+		if id, ok := rec["_id"].(string); !ok || len(id) == 0 {
+			rec["_id"] = s.newID()
+		}
+		if i := c.find(rec); i >= 0 {
+			rec["_id"] = c.records[i]["_id"]
+			c.records[i] = rec
+			continue
+		}
+		c.records = append(c.records, rec)
+	}
+	sort.SliceStable(c.records, func(i, j int) bool {
+		return compareValues(c.records[i][c.sortField], c.records[j][c.sortField]) > 0
+	})
+	return recs
+}
+
+// isoLayout is the format of JavaScript's Date.toISOString,
+// which Nightscout uses to store created_at times.
+const isoLayout = "2006-01-02T15:04:05.000Z"
+
+func normalizeCreated(rec record) {
+	v, ok := rec["created_at"].(string)
+	if !ok {
+		return
+	}
+	t, err := parseTime(v)
+	if err == nil {
+		rec["created_at"] = t.UTC().Format(isoLayout)
+	}
+}
+
+// find returns the index of the record with the same key fields as rec, or -1.
+func (c *collection) find(rec record) int {
+	if len(c.keyFields) == 0 {
+		return -1
+	}
+	for i, r := range c.records {
+		same := true
+		for _, f := range c.keyFields {
+			if compareValues(r[f], rec[f]) != 0 {
+				same = false
+				break
+			}
+		}
+		if same {
+			return i
+		}
+	}
+	return -1
+}
+
+// replace replaces the record with the same ID as rec.
+func (s *Server) replace(name string, rec record) bool {
+	c := s.collections[name]
+	for i, r := range c.records {
+		if r["_id"] == rec["_id"] {
+			c.records[i] = rec
+			return true
+		}
+	}
+	return false
+}
+
+// remove deletes the record with the given ID.
+func (s *Server) remove(name string, id string) bool {
+	c := s.collections[name]
+	for i, r := range c.records {
+		if r["_id"] == id {
+			c.records = append(c.records[:i], c.records[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// serveHTTP dispatches requests after applying authentication and injected faults.
+func (s *Server) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	latency := s.latency
+	code, inject := s.nextFault()
+	s.mu.Unlock()
+	if latency != 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if inject {
+		if code == 0 {
+			dropConnection(rw)
+			return
+		}
+		writeError(rw, code, "injected failure")
+		return
+	}
+	if !s.authorized(r) {
+		writeError(rw, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	s.route(rw, r)
+}
+
+func (s *Server) nextFault() (int, bool) {
+	if len(s.faults) == 0 {
+		return 0, false
+	}
+	f := &s.faults[0]
+	code := f.code
+	f.remaining--
+	if f.remaining == 0 {
+		s.faults = s.faults[1:]
+	}
+	return code, true
+}
+
+func dropConnection(rw http.ResponseWriter) {
+	h, ok := rw.(http.Hijacker)
+	if !ok {
+		panic("nightscouttest: connection cannot be hijacked")
+	}
+	conn, _, err := h.Hijack()
+	if err != nil {
+		return
+	}
+	// Send something other than an HTTP response before closing the connection.
+	// Closing it silently would let the client retry the request transparently.
+	_, _ = conn.Write([]byte("\x00\r\n\r\n"))
+	conn.Close()
+}
+
+// authorized checks the api-secret header, which may be the secret itself
+// or its SHA-1 digest, and the token query parameter.
+func (s *Server) authorized(r *http.Request) bool {
+	if len(s.secret) == 0 {
+		return true
+	}
+	h := r.Header.Get("api-secret")
+	if h == s.secret || strings.ToLower(h) == s.hash {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(token) != 0 && s.tokens[token]
+}
+
+func (s *Server) route(rw http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.Trim(r.URL.Path, "/"), ".json")
+	switch {
+	case path == "status" || path == "api/v1/status":
+		s.serveStatus(rw, r)
+	case path == "pebble":
+		s.servePebble(rw, r)
+	case path == "sgv":
+		s.serveRecords(rw, r, "entries", "sgv")
+	case path == "api/v1/entries":
+		s.serveRecords(rw, r, "entries", "")
+	case strings.HasPrefix(path, "api/v1/entries/") && r.Method == "GET":
+		s.serveRecords(rw, r, "entries", strings.TrimPrefix(path, "api/v1/entries/"))
+	case path == "api/v1/treatments":
+		s.serveRecords(rw, r, "treatments", "")
+	case strings.HasPrefix(path, "api/v1/treatments/") && r.Method == "DELETE":
+		s.serveDelete(rw, "treatments", strings.TrimPrefix(path, "api/v1/treatments/"))
+	case path == "api/v1/devicestatus":
+		s.serveRecords(rw, r, "devicestatus", "")
+	case path == "api/v1/profile":
+		s.serveRecords(rw, r, "profile", "")
+	case path == "api/v1/profile/current" && r.Method == "GET":
+		s.serveCurrentProfile(rw)
+	default:
+		writeError(rw, http.StatusNotFound, "Not Found")
+	}
+}
+
+// serveRecords handles GET, POST, and PUT requests for a collection.
+// For entries, typ restricts a GET request to entries of that type.
+func (s *Server) serveRecords(rw http.ResponseWriter, r *http.Request, name string, typ string) {
+	switch r.Method {
+	case "GET":
+		f, err := parseFilter(r.URL.Query())
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(typ) != 0 {
+			f.conds = append(f.conds, condition{field: "type", op: "$eq", values: []string{typ}})
+		}
+		if name == "profile" {
+			// Nightscout returns all profile records.
+			f.count = -1
+		}
+		s.mu.Lock()
+		for i := range f.conds {
+			f.conds[i].raw = s.stringTimes
+		}
+		result := f.apply(s.collections[name].records)
+		s.mu.Unlock()
+		writeJSON(rw, result)
+	case "POST", "PUT":
+		var buf bytes.Buffer
+		_, err := buf.ReadFrom(r.Body)
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		recs, err := decodeRecords(buf.Bytes())
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.Method == "POST" {
+			writeJSON(rw, s.insert(name, recs))
+			return
+		}
+		for _, rec := range recs {
+			if s.stringTimes {
+				normalizeCreated(rec)
+			}
+			if !s.replace(name, rec) {
+				s.insert(name, []record{rec})
+			}
+		}
+		writeJSON(rw, recs)
+	default:
+		writeError(rw, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (s *Server) serveDelete(rw http.ResponseWriter, name string, id string) {
+	s.mu.Lock()
+	found := s.remove(name, id)
+	s.mu.Unlock()
+	n := 0
+	if found {
+		n = 1
+	}
+	writeJSON(rw, map[string]int{"n": n, "ok": 1})
+}
+
+func (s *Server) serveCurrentProfile(rw http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recs := s.collections["profile"].records
+	if len(recs) == 0 {
+		writeJSON(rw, record{})
+		return
+	}
+	writeJSON(rw, recs[0])
+}
+
+func (s *Server) serveStatus(rw http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	writeJSON(rw, map[string]interface{}{
+		"status":            "ok",
+		"name":              "nightscout",
+		"version":           "14.2.6",
+		"serverTime":        now.UTC().Format(time.RFC3339Nano),
+		"serverTimeEpoch":   nightscout.Date(now),
+		"apiEnabled":        true,
+		"careportalEnabled": true,
+		"settings": map[string]interface{}{
+			"units": "mg/dl",
+		},
+	})
+}
+
+// servePebble serves the most recent glucose values in the format of
+// the Nightscout and xDrip pebble endpoint.
+func (s *Server) servePebble(rw http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(r.URL.Query().Get("count")) == 0 {
+		f.count = 1
+	}
+	f.conds = append(f.conds, condition{field: "type", op: "$eq", values: []string{"sgv"}})
+	s.mu.Lock()
+	recs := f.apply(s.collections["entries"].records)
+	s.mu.Unlock()
+	bgs := []map[string]interface{}{}
+	for i, rec := range recs {
+		bg := map[string]interface{}{
+			"sgv":       fmt.Sprint(rec["sgv"]),
+			"direction": rec["direction"],
+			"datetime":  rec["date"],
+		}
+		if i+1 < len(recs) {
+			bg["bgdelta"] = toFloat(rec["sgv"]) - toFloat(recs[i+1]["sgv"])
+		}
+		bgs = append(bgs, bg)
+	}
+	writeJSON(rw, map[string]interface{}{
+		"status": []map[string]interface{}{{"now": nightscout.Date(time.Now())}},
+		"bgs":    bgs,
+		"cals":   []interface{}{},
+	})
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+// writeError writes an error response in the format used by Nightscout.
+func writeError(rw http.ResponseWriter, code int, message string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+		"status":      code,
+		"message":     http.StatusText(code),
+		"description": message,
+	})
+}
@@ -0,0 +1,309 @@
+package nightscouttest_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ecc1/nightscout"
+	"github.com/ecc1/nightscout/nightscouttest"
+)
+
+const secret = "0123456789ab"
+
+// sgvEntries returns n entries at 5-minute intervals ending at t,
+// most recent first.
+func sgvEntries(t time.Time, n int) nightscout.Entries {
+	entries := make(nightscout.Entries, n)
+	for i := range entries {
+		entries[i] = nightscout.Entry{
+			Type:       nightscout.SGVType,
+			Date:       nightscout.Date(t),
+			DateString: t.Format(nightscout.DateStringLayout),
+			Device:     "test",
+			SGV:        100 + i,
+		}
+		t = t.Add(-5 * time.Minute)
+	}
+	return entries
+}
+
+func TestEntries(t *testing.T) {
+	s := nightscouttest.NewServer(secret)
+	defer s.Close()
+	w := s.Site()
+	entries := sgvEntries(time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC), 30)
+	err := w.UploadEntries(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Uploading the same entries again replaces them.
+	err = w.UploadEntries(entries[:5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Entries(), entries) {
+		t.Errorf("server has %v, want %v", s.Entries(), entries)
+	}
+	latest, err := w.QueryEntries(nightscout.NewQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(latest, entries[:nightscouttest.DefaultCount]) {
+		t.Errorf("query without count returned %v, want %v", latest, entries[:nightscouttest.DefaultCount])
+	}
+	q := nightscout.NewQuery().Gt("date", entries[5].Date).Lte("dateString", entries[2].Time()).Ne("sgv", 103)
+	got, err := w.QueryEntries(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nightscout.Entries{entries[2], entries[4]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryEntries(%v) == %v, want %v", q, got, want)
+	}
+	w.SetPageSize(7)
+	got, err = w.EntriesBetween(entries[len(entries)-1].Time(), entries[0].Time())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("EntriesBetween returned %v, want %v", got, entries)
+	}
+}
+
+func TestEntryTypes(t *testing.T) {
+	s := nightscouttest.NewServer(secret)
+	defer s.Close()
+	entries := sgvEntries(time.Now(), 3)
+	entries[1].Type = nightscout.MBGType
+	entries[1].MBG = 110
+	s.AddEntries(entries)
+	w := s.Site()
+	var got nightscout.Entries
+	err := w.Get("api/v1/entries/mbg.json", &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].MBG != 110 {
+		t.Errorf("mbg entries == %v", got)
+	}
+	q := nightscout.NewQuery().In("type", nightscout.SGVType, nightscout.MBGType)
+	got, err = w.QueryEntries(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Errorf("QueryEntries(%v) returned %d entries, want 3", q, len(got))
+	}
+	latest, err := w.XDripEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 2 {
+		t.Errorf("XDripEntries returned %d entries, want 2", len(latest))
+	}
+	now, err := w.XDripTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(now) > time.Minute {
+		t.Errorf("XDripTime() == %v", now)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s := nightscouttest.NewServer(secret)
+	defer s.Close()
+	w := s.Site()
+	for _, token := range []string{"wrong secret", "token=" + "reader-0123456789abcdef"} {
+		w.Token = token
+		_, err := w.DownloadEntries(1)
+		if !nightscout.IsUnauthorized(err) {
+			t.Errorf("DownloadEntries with secret %q returned %v, want 401", token, err)
+		}
+	}
+	// Nightscout uploaders send the SHA-1 digest of the secret.
+	sum := sha1.Sum([]byte(secret))
+	for _, token := range []string{secret, hex.EncodeToString(sum[:]), "token=" + s.Token("reader")} {
+		w.Token = token
+		_, err := w.DownloadEntries(1)
+		if err != nil {
+			t.Errorf("DownloadEntries with secret %q returned %v", token, err)
+		}
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s := nightscouttest.NewServer(secret)
+	defer s.Close()
+	w := s.Site()
+	s.FailNext(1, http.StatusInternalServerError)
+	_, err := w.DownloadEntries(1)
+	if nightscout.StatusCode(err) != http.StatusInternalServerError {
+		t.Errorf("DownloadEntries returned %v, want status 500", err)
+	}
+	s.FailNext(1, 0)
+	_, err = w.DownloadEntries(1)
+	if err == nil || nightscout.StatusCode(err) != 0 {
+		t.Errorf("DownloadEntries returned %v, want network error", err)
+	}
+	w.SetRetryPolicy(nightscout.RetryPolicy{
+		MaxAttempts:     3,
+		MinBackoff:      time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+		RetryableStatus: []int{http.StatusServiceUnavailable},
+	})
+	s.FailNext(2, http.StatusServiceUnavailable)
+	_, err = w.DownloadEntries(1)
+	if err != nil {
+		t.Errorf("DownloadEntries returned %v after retries", err)
+	}
+	if n := len(s.Requests()); n != 5 {
+		t.Errorf("server received %d requests, want 5", n)
+	}
+	s.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = w.DownloadEntriesContext(ctx, 1)
+	if err != context.DeadlineExceeded {
+		t.Errorf("DownloadEntriesContext returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTreatmentsAndProfiles(t *testing.T) {
+	s := nightscouttest.NewServer(secret)
+	defer s.Close()
+	w := s.Site()
+	now := time.Now().Truncate(time.Second)
+	err := w.UploadTreatments([]nightscout.Treatment{
+		nightscout.NewNote(now.Add(-time.Hour), "first"),
+		nightscout.NewNote(now, "second"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	treatments := s.Treatments()
+	if len(treatments) != 2 || treatments[0].Notes != "second" || len(treatments[0].ID) == 0 {
+		t.Fatalf("server has treatments %+v", treatments)
+	}
+	err = w.DeleteTreatment(treatments[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := w.LatestTreatmentTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.Equal(now.Add(-time.Hour)) {
+		t.Errorf("LatestTreatmentTime() == %v, want %v", latest, now.Add(-time.Hour))
+	}
+	s.AddProfile(nightscout.Profile{StartDate: now, DefaultProfile: "Default"})
+	err = w.UpdateProfile(nightscout.Profile{StartDate: now, DefaultProfile: "Updated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := s.Profiles()
+	if len(profiles) != 1 || profiles[0].DefaultProfile != "Updated" {
+		t.Errorf("server has profiles %+v", profiles)
+	}
+}
+
+func TestSync(t *testing.T) {
+	src := nightscouttest.NewServer(secret)
+	defer src.Close()
+	dst := nightscouttest.NewServer("")
+	defer dst.Close()
+	now := time.Now()
+	entries := sgvEntries(now.Add(-time.Minute), 24)
+	src.AddEntries(entries)
+	dst.AddEntries(entries[:5])
+	dst.AddEntries(entries[12:])
+	note := nightscout.NewNote(now.Add(-time.Hour), "note")
+	src.AddTreatments([]nightscout.Treatment{note, nightscout.NewSiteChange(now.Add(-90 * time.Minute))})
+	note.Notes = "edited"
+	dst.AddTreatments([]nightscout.Treatment{note, nightscout.NewSensorStart(now.Add(-30 * time.Minute))})
+	dst.AddDeviceStatus([]nightscout.DeviceStatus{{CreatedAt: now.Add(-time.Minute), Device: "openaps://rig"}})
+	src.AddProfile(nightscout.Profile{StartDate: now.Add(-24 * time.Hour), DefaultProfile: "Default"})
+
+	r, err := nightscout.Sync(src.Site(), dst.Site(), nightscout.SyncOptions{
+		Mode:  nightscout.TwoWay,
+		Since: now.Add(-3 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nightscout.SyncReport{
+		ToDest:   nightscout.SyncCounts{Entries: 7, Treatments: 1, Profiles: 1},
+		ToSource: nightscout.SyncCounts{Treatments: 1, DeviceStatus: 1},
+	}
+	conflicts := r.Conflicts
+	r.Conflicts = nil
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Sync returned %+v, want %+v", r, want)
+	}
+	if len(conflicts) != 1 || conflicts[0].Collection != "treatments" {
+		t.Errorf("Sync reported conflicts %v, want 1 treatment", conflicts)
+	}
+	if !reflect.DeepEqual(dst.Entries(), entries) {
+		t.Errorf("destination has %d entries, want %d", len(dst.Entries()), len(entries))
+	}
+	if len(src.Treatments()) != 3 || len(dst.Treatments()) != 3 {
+		t.Errorf("source has %d treatments and destination has %d, want 3", len(src.Treatments()), len(dst.Treatments()))
+	}
+	if len(src.DeviceStatus()) != 1 || len(dst.Profiles()) != 1 {
+		t.Errorf("devicestatus and profiles were not copied")
+	}
+}
+
+func TestSyncStringTimes(t *testing.T) {
+	src := nightscouttest.NewServer("")
+	defer src.Close()
+	dst := nightscouttest.NewServer("")
+	defer dst.Close()
+	src.SetStringTimes(true)
+	dst.SetStringTimes(true)
+	since := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	var treatments []nightscout.Treatment
+	var status []nightscout.DeviceStatus
+	for i := 0; i < 5; i++ {
+		ms := time.Duration(100*i) * time.Millisecond
+		// Records in the same second as the start of the range.
+		treatments = append(treatments, nightscout.NewNote(since.Add(ms), "start"))
+		// More records in one second than fit in a page.
+		treatments = append(treatments, nightscout.NewNote(since.Add(time.Hour+ms), "middle"))
+		status = append(status, nightscout.DeviceStatus{CreatedAt: since.Add(30*time.Minute + ms), Device: "openaps://rig"})
+	}
+	src.AddTreatments(treatments)
+	src.AddDeviceStatus(status)
+
+	w := src.Site()
+	w.SetPageSize(3)
+	opts := nightscout.SyncOptions{Mode: nightscout.TwoWay, Since: since}
+	r, err := nightscout.Sync(w, dst.Site(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nightscout.SyncCounts{Treatments: len(treatments), DeviceStatus: len(status)}
+	if r.ToDest != want || r.ToSource != (nightscout.SyncCounts{}) || len(r.Conflicts) != 0 {
+		t.Errorf("Sync returned %+v, want %+v copied to destination", r, want)
+	}
+	if len(dst.Treatments()) != len(treatments) || len(dst.DeviceStatus()) != len(status) {
+		t.Errorf("destination has %d treatments and %d devicestatus records, want %d and %d",
+			len(dst.Treatments()), len(dst.DeviceStatus()), len(treatments), len(status))
+	}
+
+	// Nothing is missing from either website now.
+	d := dst.Site()
+	d.SetPageSize(3)
+	r, err = nightscout.Sync(w, d, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ToDest != (nightscout.SyncCounts{}) || r.ToSource != (nightscout.SyncCounts{}) {
+		t.Errorf("second Sync returned %+v, want nothing copied", r)
+	}
+}
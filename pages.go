@@ -0,0 +1,219 @@
+package nightscout
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+const (
+	// DefaultPageSize is the number of entries requested per page
+	// when downloading a range of entries.
+	DefaultPageSize = 1000
+)
+
+// PageSize returns the number of entries requested per page.
+func (w *Website) PageSize() int {
+	if w.pageSize <= 0 {
+		return DefaultPageSize
+	}
+	return w.pageSize
+}
+
+// SetPageSize sets the number of entries requested per page.
+func (w *Website) SetPageSize(n int) {
+	w.pageSize = n
+}
+
+// EntryIterator returns the entries in a time range one at a time,
+// in reverse chronological order, downloading them a page at a time.
+type EntryIterator struct {
+	ctx      context.Context
+	w        Website
+	start    int64
+	cursor   int64
+	pageSize int
+	page     Entries
+	done     bool
+	// Entries already returned with the current date,
+	// used to remove duplicates at page boundaries.
+	seenDate int64
+	seen     Entries
+}
+
+// IterateEntries returns an iterator over the Nightscout entries
+// between start and end, inclusive.
+func (w Website) IterateEntries(start, end time.Time) *EntryIterator {
+	return w.IterateEntriesContext(context.Background(), start, end)
+}
+
+// IterateEntriesContext returns an iterator over the Nightscout entries
+// between start and end, inclusive, using the given context.
+func (w Website) IterateEntriesContext(ctx context.Context, start, end time.Time) *EntryIterator {
+	return &EntryIterator{
+		ctx:      ctx,
+		w:        w,
+		start:    Date(start),
+		cursor:   Date(end),
+		pageSize: w.PageSize(),
+		seenDate: -1,
+	}
+}
+
+// Next returns the next entry.
+// It returns io.EOF when there are no more entries.
+func (it *EntryIterator) Next() (Entry, error) {
+	for {
+		for len(it.page) != 0 {
+			e := it.page[0]
+			it.page = it.page[1:]
+			if it.isDuplicate(e) {
+				continue
+			}
+			return e, nil
+		}
+		page, err := it.nextPage()
+		if err != nil {
+			return Entry{}, err
+		}
+		it.page = page
+	}
+}
+
+func (it *EntryIterator) isDuplicate(e Entry) bool {
+	if e.Date != it.seenDate {
+		it.seenDate = e.Date
+		it.seen = it.seen[:0]
+	}
+	for _, x := range it.seen {
+		if x == e {
+			return true
+		}
+	}
+	it.seen = append(it.seen, e)
+	return false
+}
+
+// nextPage downloads the next page of entries
+// and moves the cursor back to the earliest one.
+// The cursor is inclusive, so entries with the same date
+// may appear at the end of one page and the start of the next.
+func (it *EntryIterator) nextPage() (Entries, error) {
+	if it.done || it.cursor < it.start {
+		return nil, io.EOF
+	}
+	q := NewQuery().Gte("date", it.start).Lte("date", it.cursor).Count(it.pageSize)
+	page, err := it.w.QueryEntriesContext(it.ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(page) < it.pageSize {
+		it.done = true
+	}
+	if len(page) == 0 {
+		return nil, io.EOF
+	}
+	page.Sort()
+	last := page[len(page)-1].Date
+	if last == it.cursor && !it.done {
+		// The whole page has the same date, so retrieve all the
+		// entries with that date and move the cursor past it.
+		page, err = it.allWithDate(last)
+		if err != nil {
+			return nil, err
+		}
+		last--
+	}
+	it.cursor = last
+	return page, nil
+}
+
+func (it *EntryIterator) allWithDate(date int64) (Entries, error) {
+	for n := 2 * it.pageSize; ; n *= 2 {
+		q := NewQuery().Gte("date", date).Lte("date", date).Count(n)
+		page, err := it.w.QueryEntriesContext(it.ctx, q)
+		if err != nil || len(page) < n {
+			page.Sort()
+			return page, err
+		}
+	}
+}
+
+// EntriesBetween downloads the Nightscout entries between start and end, inclusive,
+// in reverse chronological order.
+func (w Website) EntriesBetween(start, end time.Time) (Entries, error) {
+	return w.EntriesBetweenContext(context.Background(), start, end)
+}
+
+// EntriesBetweenContext downloads the Nightscout entries between start and end, inclusive,
+// in reverse chronological order, using the given context.
+func (w Website) EntriesBetweenContext(ctx context.Context, start, end time.Time) (Entries, error) {
+	it := w.IterateEntriesContext(ctx, start, end)
+	var entries Entries
+	for {
+		page, err := it.nextPage()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = MergeEntries(entries, page)
+	}
+}
+
+// walkCreated calls fetch for successive pages of records
+// whose created_at time is between start and end, inclusive,
+// most recent first. Since created_at values are compared as strings,
+// the range is widened to whole seconds, so pages may overlap
+// and callers must remove duplicates and records outside the range.
+func (w Website) walkCreated(start, end time.Time, fetch func(q *Query) ([]time.Time, error)) error {
+	pageSize := w.PageSize()
+	first := start.Truncate(time.Second)
+	cursor := end.Truncate(time.Second)
+	for !cursor.Before(first) {
+		times, err := fetch(createdQuery(first, cursor, pageSize))
+		if err != nil || len(times) < pageSize {
+			return err
+		}
+		oldest := times[0]
+		for _, t := range times[1:] {
+			if t.Before(oldest) {
+				oldest = t
+			}
+		}
+		next := oldest.Truncate(time.Second)
+		if !next.Before(cursor) {
+			// The whole page is within one second, so retrieve all the
+			// records in that second and move the cursor past it.
+			err = allInSecond(cursor, pageSize, fetch)
+			if err != nil {
+				return err
+			}
+			next = cursor.Add(-time.Second)
+		}
+		cursor = next
+	}
+	return nil
+}
+
+func allInSecond(t time.Time, pageSize int, fetch func(q *Query) ([]time.Time, error)) error {
+	for n := 2 * pageSize; ; n *= 2 {
+		times, err := fetch(createdQuery(t, t, n))
+		if err != nil || len(times) < n {
+			return err
+		}
+	}
+}
+
+// createdQuery returns a query for up to count records
+// whose created_at time is within the seconds from first to last, inclusive.
+// Nightscout stores created_at strings in UTC with milliseconds,
+// so the bounds are formatted the same way to compare correctly as strings.
+func createdQuery(first, last time.Time, count int) *Query {
+	const layout = "2006-01-02T15:04:05"
+	return NewQuery().
+		Gte("created_at", first.UTC().Format(layout)+".000Z").
+		Lte("created_at", last.UTC().Format(layout)+".999Z").
+		Count(count)
+}
@@ -0,0 +1,88 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// entryServer returns a handler that serves the given entries,
+// honoring the date range and count parameters.
+func entryServer(entries Entries, requests *int) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		*requests++
+		q := r.URL.Query()
+		gte, _ := strconv.ParseInt(q.Get("find[date][$gte]"), 10, 64)
+		lte, _ := strconv.ParseInt(q.Get("find[date][$lte]"), 10, 64)
+		count, _ := strconv.Atoi(q.Get("count"))
+		v := Entries{}
+		for _, e := range entries {
+			if e.Date >= gte && e.Date <= lte && len(v) < count {
+				v = append(v, e)
+			}
+		}
+		_ = json.NewEncoder(rw).Encode(v)
+	}
+}
+
+func TestEntriesBetween(t *testing.T) {
+	// Add MBG entries with the same dates as some SGV entries.
+	all := E.sorted()
+	for _, i := range []int{2, 5, 6, 15} {
+		all = append(all, Entry{Type: MBGType, Date: E[i].Date})
+	}
+	all.Sort()
+	cases := []struct {
+		pageSize int
+		start    int
+		end      int
+	}{
+		{1000, 19, 0},
+		{3, 19, 0},
+		{4, 19, 0},
+		{5, 17, 2},
+		{2, 15, 5},
+		{1, 6, 6},
+	}
+	for _, c := range cases {
+		t.Run("", func(t *testing.T) {
+			start := T[c.start]
+			end := T[c.end]
+			var want Entries
+			for _, e := range all {
+				if e.Date >= Date(start) && e.Date <= Date(end) {
+					want = append(want, e)
+				}
+			}
+			requests := 0
+			w, cleanup := testSite(t, entryServer(all, &requests))
+			defer cleanup()
+			w.SetPageSize(c.pageSize)
+			entries, err := w.EntriesBetween(start, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, want) {
+				t.Errorf("EntriesBetween(%v, %v) == %v, want %v", start, end, entries, want)
+			}
+			var iterated Entries
+			it := w.IterateEntries(start, end)
+			for {
+				e, err := it.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				iterated = append(iterated, e)
+			}
+			if !reflect.DeepEqual(iterated, want) {
+				t.Errorf("IterateEntries(%v, %v) == %v, want %v", start, end, iterated, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package nightscout
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// PredictionStep is the interval between predicted values.
+	PredictionStep = 5 * time.Minute
+
+	// decayTime is the time constant of the exponential-decay model:
+	// the rate of change falls by a factor of e every decayTime minutes.
+	decayTime = 15.0
+)
+
+// predictionHistory selects the entries used by Predict.
+var predictionHistory = TrendClassifier{
+	MaxEntries: 7,
+	Window:     30 * time.Minute,
+	MaxGap:     15 * time.Minute,
+	Interval:   5 * time.Minute,
+}
+
+// RateOfChange returns the rate of change of glucose in mg/dL per minute,
+// using the same entries as Trend, and the coefficient of determination (R²)
+// of the fitted line as a measure of confidence, from 0 to 1.
+// The entries must be in reverse chronological order.
+func RateOfChange(entries Entries) (float64, float64, error) {
+	return DefaultTrend.RateOfChange(entries)
+}
+
+// RateOfChange returns the rate of change of glucose in mg/dL per minute,
+// using the entries that the classifier would use,
+// and the coefficient of determination (R²) of the fitted line.
+// The entries must be in reverse chronological order.
+func (c TrendClassifier) RateOfChange(entries Entries) (float64, float64, error) {
+	p, err := c.points(entries)
+	if err != nil {
+		return 0, 0, err
+	}
+	line, err := c.fit(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	return line.Slope, line.RSquared(p), nil
+}
+
+// Prediction holds glucose values projected by several models.
+// Value i of each model is the prediction for Time(i).
+type Prediction struct {
+	// Start is the time of the most recent entry.
+	Start time.Time
+	// Linear extrapolates a line fitted to the recent entries.
+	Linear []float64
+	// Quadratic extrapolates a parabola fitted to the recent entries.
+	Quadratic []float64
+	// Exponential assumes that the current rate of change decays exponentially,
+	// so glucose levels off instead of changing indefinitely.
+	Exponential []float64
+}
+
+// Time returns the time of predicted value i.
+func (p Prediction) Time(i int) time.Time {
+	return p.Start.Add(time.Duration(i+1) * PredictionStep)
+}
+
+// Predict projects glucose values at PredictionStep intervals up to the given horizon,
+// using the entries from the last 30 minutes.
+// The entries must be in reverse chronological order.
+// If there are only two recent entries, the quadratic model is the same as the linear one.
+func Predict(entries Entries, horizon time.Duration) (Prediction, error) {
+	if horizon < 0 {
+		return Prediction{}, fmt.Errorf("invalid horizon %v", horizon)
+	}
+	p, err := predictionHistory.points(entries)
+	if err != nil {
+		return Prediction{}, err
+	}
+	line, err := FindLine(p)
+	if err != nil {
+		return Prediction{}, err
+	}
+	quad := line.quadratic()
+	if p.Len() >= 3 {
+		quad = fitQuadratic(p, line)
+	}
+	n := int(horizon / PredictionStep)
+	pred := Prediction{
+		Start:       entries[0].Time(),
+		Linear:      make([]float64, n),
+		Quadratic:   make([]float64, n),
+		Exponential: make([]float64, n),
+	}
+	y0 := line.Intercept
+	for i := 0; i < n; i++ {
+		x := float64(i+1) * PredictionStep.Minutes()
+		pred.Linear[i] = line.Eval(x)
+		pred.Quadratic[i] = quad.Eval(x)
+		pred.Exponential[i] = y0 + line.Slope*decayTime*(1-math.Exp(-x/decayTime))
+	}
+	return pred, nil
+}
+
+// relPoints holds entries with x-coordinates in minutes relative to the most recent one,
+// which avoids the loss of precision from using Unix times.
+type relPoints struct {
+	x []float64
+	y []float64
+}
+
+func (p relPoints) Len() int {
+	return len(p.x)
+}
+
+func (p relPoints) X(i int) float64 {
+	return p.x[i]
+}
+
+func (p relPoints) Y(i int) float64 {
+	return p.y[i]
+}
+
+// points returns the entries that the classifier would use,
+// relative to the most recent one.
+func (c TrendClassifier) points(entries Entries) (relPoints, error) {
+	if len(entries) == 0 || entries[0].Type != SGVType {
+		return relPoints{}, fmt.Errorf("most recent entry is not a glucose value")
+	}
+	history := c.history(entries)
+	if len(history) < 2 || len(history) < c.MinPoints {
+		return relPoints{}, fmt.Errorf("not enough recent glucose values (%d)", len(history))
+	}
+	t0 := history[0].Time()
+	p := relPoints{
+		x: make([]float64, len(history)),
+		y: make([]float64, len(history)),
+	}
+	for i, e := range history {
+		p.x[i] = e.Time().Sub(t0).Minutes()
+		p.y[i] = float64(e.SGV)
+	}
+	return p, nil
+}
+
+// quadraticCurve represents the equation y = A*x² + B*x + C.
+type quadraticCurve struct {
+	A, B, C float64
+}
+
+func (q quadraticCurve) Eval(x float64) float64 {
+	return (q.A*x+q.B)*x + q.C
+}
+
+func (l Line) quadratic() quadraticCurve {
+	return quadraticCurve{B: l.Slope, C: l.Intercept}
+}
+
+// fitQuadratic performs least-squares quadratic regression on at least 3 points
+// by solving the normal equations with Cramer's rule.
+// The line fitted to the same points is used if the equations are singular.
+func fitQuadratic(p Points, line Line) quadraticCurve {
+	var s [5]float64 // sums of x^k
+	var t [3]float64 // sums of y*x^k
+	for i := 0; i < p.Len(); i++ {
+		x, y := p.X(i), p.Y(i)
+		xk := 1.0
+		for k := 0; k < 5; k++ {
+			s[k] += xk
+			if k < 3 {
+				t[k] += y * xk
+			}
+			xk *= x
+		}
+	}
+	m := [3][3]float64{
+		{s[4], s[3], s[2]},
+		{s[3], s[2], s[1]},
+		{s[2], s[1], s[0]},
+	}
+	d := det3(m)
+	if d == 0 {
+		// All points have at most 2 distinct x-coordinates.
+		return line.quadratic()
+	}
+	var coef [3]float64
+	for j := 0; j < 3; j++ {
+		mj := m
+		for i := 0; i < 3; i++ {
+			mj[i][j] = t[2-i]
+		}
+		coef[j] = det3(mj) / d
+	}
+	return quadraticCurve{A: coef[0], B: coef[1], C: coef[2]}
+}
+
+func det3(m [3][3]float64) float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
@@ -0,0 +1,77 @@
+package nightscout
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRateOfChange(t *testing.T) {
+	cases := []struct {
+		entries    Entries
+		rate       float64
+		confidence float64
+	}{
+		{sgvEntries(120, 110, 100, 90), 2, 1},
+		{sgvEntries(100, 100, 100), 0, 1},
+		{sgvEntries(102, 98, 97, 99), 0.2, 5.0 / 14},
+	}
+	for _, c := range cases {
+		rate, confidence, err := RateOfChange(c.entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !closeEnough(rate, c.rate) || !closeEnough(confidence, c.confidence) {
+			t.Errorf("RateOfChange(%v) == %v, %v, want %v, %v", c.entries, rate, confidence, c.rate, c.confidence)
+		}
+	}
+	for _, entries := range []Entries{nil, sgvEntries(100), {{Type: MBGType, MBG: 100}}} {
+		_, _, err := RateOfChange(entries)
+		if err == nil {
+			t.Errorf("RateOfChange(%v) succeeded", entries)
+		}
+	}
+}
+
+func TestPredict(t *testing.T) {
+	// Falling by 2 mg/dL/min.
+	linear := sgvEntries(100, 110, 120, 130, 140, 150, 160)
+	p, err := Predict(linear, 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Linear) != 6 || !p.Time(5).Equal(linear[0].Time().Add(30*time.Minute)) {
+		t.Fatalf("Predict returned %d values ending at %v", len(p.Linear), p.Time(len(p.Linear)-1))
+	}
+	prev := 100.0
+	for i := range p.Linear {
+		want := 100 - 10*float64(i+1)
+		if !closeEnough(p.Linear[i], want) || !closeEnough(p.Quadratic[i], want) {
+			t.Errorf("linear and quadratic predictions %d == %v, %v, want %v", i, p.Linear[i], p.Quadratic[i], want)
+		}
+		// The exponential model falls more slowly, towards 100 - 2*15.
+		e := p.Exponential[i]
+		if e >= prev || e <= want || e <= 70 {
+			t.Errorf("exponential prediction %d == %v, want between %v and %v", i, e, math.Max(want, 70), prev)
+		}
+		prev = e
+	}
+
+	// y = 0.2x² + 2x + 100, for x = 0, -5, ..., -30 minutes.
+	quadratic := sgvEntries(100, 95, 100, 115, 140, 175, 220)
+	p, err = Predict(quadratic, 20*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range p.Quadratic {
+		x := 5 * float64(i+1)
+		want := 0.2*x*x + 2*x + 100
+		if math.Abs(v-want) > 1e-9 {
+			t.Errorf("quadratic prediction %d == %v, want %v", i, v, want)
+		}
+	}
+	_, err = Predict(quadratic, -5*time.Minute)
+	if err == nil {
+		t.Errorf("Predict with negative horizon succeeded")
+	}
+}
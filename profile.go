@@ -0,0 +1,228 @@
+package nightscout
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day = 24 * time.Hour
+)
+
+// DownloadProfiles downloads the profile records from Nightscout,
+// most recent first.
+func (w Website) DownloadProfiles() ([]Profile, error) {
+	return w.DownloadProfilesContext(context.Background())
+}
+
+// DownloadProfilesContext downloads the profile records from Nightscout,
+// most recent first, using the given context.
+func (w Website) DownloadProfilesContext(ctx context.Context) ([]Profile, error) {
+	var profiles []Profile
+	err := w.GetContext(ctx, "api/v1/profile", &profiles)
+	return profiles, err
+}
+
+// UploadProfile uploads a new profile record to Nightscout.
+func (w Website) UploadProfile(p Profile) error {
+	return w.UploadProfileContext(context.Background(), p)
+}
+
+// UploadProfileContext uploads a new profile record to Nightscout
+// using the given context.
+func (w Website) UploadProfileContext(ctx context.Context, p Profile) error {
+	return w.UploadContext(ctx, "api/v1/profile", p)
+}
+
+// UpdateProfile replaces a profile record in Nightscout.
+// If the ID field is empty, the current profile record is replaced.
+func (w Website) UpdateProfile(p Profile) error {
+	return w.UpdateProfileContext(context.Background(), p)
+}
+
+// UpdateProfileContext replaces a profile record in Nightscout
+// using the given context.
+// If the ID field is empty, the current profile record is replaced.
+func (w Website) UpdateProfileContext(ctx context.Context, p Profile) error {
+	if len(p.ID) == 0 {
+		var cur ProfileID
+		err := w.GetContext(ctx, "api/v1/profile/current", &cur)
+		if err != nil {
+			return err
+		}
+		if len(cur.ID) == 0 {
+			return fmt.Errorf("no current Nightscout profile")
+		}
+		p.ID = cur.ID
+	}
+	return w.PutContext(ctx, "api/v1/profile", p)
+}
+
+// Default returns the default profile data in a profile record.
+func (p Profile) Default() (ProfileData, error) {
+	data, ok := p.Store[p.DefaultProfile]
+	if !ok {
+		return data, fmt.Errorf("default profile %q not found", p.DefaultProfile)
+	}
+	return data, nil
+}
+
+// Location returns the time zone of the profile data.
+func (p ProfileData) Location() (*time.Location, error) {
+	if len(p.TimeZone) == 0 {
+		return time.Local, nil
+	}
+	return time.LoadLocation(p.TimeZone)
+}
+
+// in converts t to the time zone of the profile data, if it is valid.
+func (p ProfileData) in(t time.Time) time.Time {
+	loc, err := p.Location()
+	if err != nil {
+		return t
+	}
+	return t.In(loc)
+}
+
+// BasalAt returns the scheduled basal rate at time t.
+func (p ProfileData) BasalAt(t time.Time) float64 {
+	return p.Basal.At(p.in(t))
+}
+
+// CarbRatioAt returns the scheduled carb ratio at time t.
+func (p ProfileData) CarbRatioAt(t time.Time) float64 {
+	return p.CarbRatio.At(p.in(t))
+}
+
+// SensAt returns the scheduled insulin sensitivity at time t.
+func (p ProfileData) SensAt(t time.Time) float64 {
+	return p.Sens.At(p.in(t))
+}
+
+// TargetLowAt returns the scheduled low target at time t.
+func (p ProfileData) TargetLowAt(t time.Time) float64 {
+	return p.TargetLow.At(p.in(t))
+}
+
+// TargetHighAt returns the scheduled high target at time t.
+func (p ProfileData) TargetHighAt(t time.Time) float64 {
+	return p.TargetHigh.At(p.in(t))
+}
+
+// At returns the value in effect at the time of day of t, in t's location,
+// or 0 if the schedule is empty or invalid.
+// Use ProfileData methods such as BasalAt to honor the profile's time zone.
+func (s Schedule) At(t time.Time) float64 {
+	// Use the wall clock time, which differs from the elapsed time
+	// since midnight on daylight saving transition days.
+	h, m, sec := t.Clock()
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	v, err := s.ValueAt(d)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// check returns an error if the schedule is empty
+// or any of its times or values is invalid.
+func (s Schedule) check() error {
+	if len(s) == 0 {
+		return fmt.Errorf("empty schedule")
+	}
+	for _, tv := range s {
+		_, err := tv.Offset()
+		if err != nil {
+			return err
+		}
+		_, err = tv.Float()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValueAt returns the value in effect at the given offset from midnight.
+// The schedule repeats daily, so an offset before the first entry
+// uses the value of the last entry.
+func (s Schedule) ValueAt(d time.Duration) (float64, error) {
+	if len(s) == 0 {
+		return 0, fmt.Errorf("empty schedule")
+	}
+	best := -1
+	var bestOffset time.Duration
+	last := -1
+	var lastOffset time.Duration
+	for i, tv := range s {
+		off, err := tv.Offset()
+		if err != nil {
+			return 0, err
+		}
+		if off <= d && (best < 0 || off >= bestOffset) {
+			best, bestOffset = i, off
+		}
+		if last < 0 || off >= lastOffset {
+			last, lastOffset = i, off
+		}
+	}
+	if best < 0 {
+		best = last
+	}
+	return s[best].Float()
+}
+
+// Offset returns the time of day at which the value takes effect,
+// as an offset from midnight.
+// The TimeAsSeconds field is used if present, otherwise the "HH:MM" Time field.
+func (tv TimeValue) Offset() (time.Duration, error) {
+	if tv.TimeAsSeconds != nil {
+		n, err := toFloat(tv.TimeAsSeconds)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timeAsSeconds: %v", err)
+		}
+		return checkOffset(time.Duration(n * float64(time.Second)))
+	}
+	parts := strings.Split(tv.Time, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid schedule time %q", tv.Time)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule time %q", tv.Time)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m >= 60 {
+		return 0, fmt.Errorf("invalid schedule time %q", tv.Time)
+	}
+	return checkOffset(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+}
+
+func checkOffset(d time.Duration) (time.Duration, error) {
+	if d < 0 || d >= day {
+		return 0, fmt.Errorf("schedule time %v is out of range", d)
+	}
+	return d, nil
+}
+
+// Float returns the value as a float64.
+// Nightscout stores values as either numbers or numeric strings.
+func (tv TimeValue) Float() (float64, error) {
+	return toFloat(tv.Value)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case int:
+		return float64(x), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(x), 64)
+	default:
+		return 0, fmt.Errorf("unexpected value %v (%T)", v, v)
+	}
+}
@@ -0,0 +1,115 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testProfile = `{
+  "_id": "5b37a7d0e1b2c3d4e5f60718",
+  "defaultProfile": "Default",
+  "startDate": "2018-06-30T00:00:00Z",
+  "created_at": "2018-06-30T00:00:00Z",
+  "store": {
+    "Default": {
+      "dia": 4,
+      "timezone": "Europe/London",
+      "units": "mg/dl",
+      "basal": [
+        {"time": "00:00", "value": "0.8", "timeAsSeconds": "0"},
+        {"time": "06:30", "value": 1.1, "timeAsSeconds": 23400},
+        {"time": "22:00", "value": "0.9"}
+      ],
+      "carbratio": [{"time": "00:00", "value": 10}],
+      "sens": [{"time": "04:00", "value": 50}, {"time": "12:00", "value": 40}],
+      "target_low": [{"time": "00:00", "value": 100}],
+      "target_high": [{"time": "00:00", "value": 120}]
+    }
+  }
+}`
+
+func TestSchedule(t *testing.T) {
+	var p Profile
+	err := json.Unmarshal([]byte(testProfile), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	london, err := data.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		t     time.Time
+		basal float64
+		sens  float64
+	}{
+		{time.Date(2018, 6, 30, 0, 0, 0, 0, london), 0.8, 40},
+		{time.Date(2018, 6, 30, 6, 29, 59, 0, london), 0.8, 50},
+		{time.Date(2018, 6, 30, 6, 30, 0, 0, london), 1.1, 50},
+		{time.Date(2018, 6, 30, 12, 0, 0, 0, london), 1.1, 40},
+		{time.Date(2018, 6, 30, 23, 59, 0, 0, london), 0.9, 40},
+		// 01:30 in New York is 06:30 in London.
+		{parseTime("2018-06-30 01:30"), 1.1, 50},
+		// Daylight saving time starts at 01:00 on 2018-03-25 in London.
+		{time.Date(2018, 3, 25, 6, 45, 0, 0, london), 1.1, 50},
+	}
+	for _, c := range cases {
+		t.Run(c.t.String(), func(t *testing.T) {
+			basal := data.BasalAt(c.t)
+			if basal != c.basal {
+				t.Errorf("BasalAt(%v) == %v, want %v", c.t, basal, c.basal)
+			}
+			sens := data.SensAt(c.t)
+			if sens != c.sens {
+				t.Errorf("SensAt(%v) == %v, want %v", c.t, sens, c.sens)
+			}
+		})
+	}
+}
+
+func TestScheduleErrors(t *testing.T) {
+	cases := []Schedule{
+		nil,
+		{{Time: "6:30am", Value: 1.0}},
+		{{Time: "25:00", Value: 1.0}},
+		{{Time: "00:00", Value: "fast"}},
+		{{Time: "00:00", Value: 1.0, TimeAsSeconds: true}},
+	}
+	for _, s := range cases {
+		_, err := s.ValueAt(0)
+		if err == nil {
+			t.Errorf("ValueAt(%+v) succeeded", s)
+		}
+		if s.At(time.Now()) != 0 {
+			t.Errorf("At(%+v) != 0", s)
+		}
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	var put ProfileID
+	w, cleanup := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v1/profile/current":
+			_, _ = rw.Write([]byte(testProfile))
+		case r.Method == "PUT" && r.URL.Path == "/api/v1/profile":
+			_ = json.NewDecoder(r.Body).Decode(&put)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+	err := w.UpdateProfile(Profile{DefaultProfile: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if put.ID != "5b37a7d0e1b2c3d4e5f60718" {
+		t.Errorf("UpdateProfile used ID %q", put.ID)
+	}
+}
@@ -0,0 +1,151 @@
+package nightscout
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query represents the parameters of a Nightscout API v1 query,
+// using the find[field][$op]=value syntax.
+// Query methods return the receiver so that calls can be chained:
+//
+//	q := NewQuery().Gte("date", Date(since)).In("type", SGVType, MBGType).Count(100)
+type Query struct {
+	params url.Values
+}
+
+// NewQuery returns an empty query.
+func NewQuery() *Query {
+	return &Query{params: url.Values{}}
+}
+
+func (q *Query) find(field string, op string, value interface{}) *Query {
+	key := "find[" + field + "]"
+	if len(op) != 0 {
+		key += "[" + op + "]"
+	}
+	q.params.Add(key, formatValue(value))
+	return q
+}
+
+// formatValue converts a query value to the form expected by Nightscout.
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case time.Time:
+		return x.Format(DateStringLayout)
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Eq restricts the query to records whose field equals value.
+func (q *Query) Eq(field string, value interface{}) *Query {
+	return q.find(field, "", value)
+}
+
+// Ne restricts the query to records whose field does not equal value.
+func (q *Query) Ne(field string, value interface{}) *Query {
+	return q.find(field, "$ne", value)
+}
+
+// Gt restricts the query to records whose field is greater than value.
+func (q *Query) Gt(field string, value interface{}) *Query {
+	return q.find(field, "$gt", value)
+}
+
+// Gte restricts the query to records whose field is greater than or equal to value.
+func (q *Query) Gte(field string, value interface{}) *Query {
+	return q.find(field, "$gte", value)
+}
+
+// Lt restricts the query to records whose field is less than value.
+func (q *Query) Lt(field string, value interface{}) *Query {
+	return q.find(field, "$lt", value)
+}
+
+// Lte restricts the query to records whose field is less than or equal to value.
+func (q *Query) Lte(field string, value interface{}) *Query {
+	return q.find(field, "$lte", value)
+}
+
+// In restricts the query to records whose field equals one of the values.
+func (q *Query) In(field string, values ...interface{}) *Query {
+	for _, v := range values {
+		q.find(field, "$in][", v)
+	}
+	return q
+}
+
+// Count limits the number of records returned.
+// Nightscout returns 10 records if no count is given.
+func (q *Query) Count(n int) *Query {
+	q.params.Set("count", strconv.Itoa(n))
+	return q
+}
+
+// Sort sorts the results by the given field in ascending order.
+func (q *Query) Sort(field string) *Query {
+	q.params.Del("sort$desc")
+	q.params.Set("sort", field)
+	return q
+}
+
+// SortDesc sorts the results by the given field in descending order.
+func (q *Query) SortDesc(field string) *Query {
+	q.params.Del("sort")
+	q.params.Set("sort$desc", field)
+	return q
+}
+
+// Fields limits the fields included in each result.
+func (q *Query) Fields(fields ...string) *Query {
+	q.params.Set("fields", strings.Join(fields, ","))
+	return q
+}
+
+// Values returns the query as URL parameters.
+func (q *Query) Values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	for key, values := range q.params {
+		v[key] = append([]string(nil), values...)
+	}
+	return v
+}
+
+// Encode returns the query in URL-encoded form.
+func (q *Query) Encode() string {
+	return q.Values().Encode()
+}
+
+// String returns the query in unescaped form, for logging.
+func (q *Query) String() string {
+	s := q.Encode()
+	u, err := url.QueryUnescape(s)
+	if err != nil {
+		return s
+	}
+	return u
+}
+
+// queryAPI returns the API path with the query parameters appended.
+func queryAPI(api string, q *Query) string {
+	params := q.Encode()
+	if len(params) == 0 {
+		return api
+	}
+	return api + "?" + params
+}
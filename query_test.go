@@ -0,0 +1,51 @@
+package nightscout
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	since := parseTime("2018-06-30 12:00")
+	cases := []struct {
+		query *Query
+		s     string
+	}{
+		{nil, ""},
+		{NewQuery(), ""},
+		{NewQuery().Count(5), "count=5"},
+		{NewQuery().Gte("dateString", since), "find[dateString][$gte]=2018-06-30T12:00:00-04:00"},
+		{NewQuery().Gt("date", Date(since)).Lt("date", int64(1530378000000)), "find[date][$gt]=1530374400000&find[date][$lt]=1530378000000"},
+		{NewQuery().Lte("sgv", 70).Ne("device", "test"), "find[device][$ne]=test&find[sgv][$lte]=70"},
+		{NewQuery().Eq("eventType", "Meal Bolus").Count(1), "count=1&find[eventType]=Meal Bolus"},
+		{NewQuery().In("type", SGVType, MBGType), "find[type][$in][]=sgv&find[type][$in][]=mbg"},
+		{NewQuery().Sort("date").SortDesc("sgv"), "sort$desc=sgv"},
+		{NewQuery().Fields("date", "sgv").Sort("date"), "fields=date,sgv&sort=date"},
+		{NewQuery().Gte("carbs", 1.5), "find[carbs][$gte]=1.5"},
+	}
+	for _, c := range cases {
+		t.Run(c.s, func(t *testing.T) {
+			s := c.query.String()
+			if s != c.s {
+				t.Errorf("String() == %q, want %q", s, c.s)
+			}
+		})
+	}
+}
+
+func TestQueryEntries(t *testing.T) {
+	var raw string
+	w, cleanup := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+		raw = r.URL.RawQuery
+		_, _ = rw.Write([]byte("[]"))
+	})
+	defer cleanup()
+	q := NewQuery().In("type", MBGType).Count(3)
+	_, err := w.QueryEntries(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != q.Encode() {
+		t.Errorf("QueryEntries sent %q, want %q", raw, q.Encode())
+	}
+}
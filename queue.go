@@ -0,0 +1,385 @@
+package nightscout
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// UploadQueue is a durable queue of pending Nightscout uploads.
+// It is stored as a write-ahead journal: each upload and each completion
+// is appended to the file and synced before it takes effect,
+// so the queue survives process restarts and crashes.
+type UploadQueue struct {
+	mu      sync.Mutex
+	file    string
+	f       *os.File
+	pending []journalRecord
+	keys    map[string]bool
+	seq     uint64
+}
+
+// journalRecord represents a line in the journal.
+// A record with data is a pending upload;
+// a record with Done set marks the upload with that sequence number as complete.
+type journalRecord struct {
+	Seq  uint64          `json:"seq"`
+	API  string          `json:"api,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"` // JSON array of records
+	Done bool            `json:"done,omitempty"`
+}
+
+// OpenQueue opens the upload queue stored in the given file,
+// creating it if necessary.
+// An incomplete record at the end of the journal,
+// left by a crash during a write, is discarded.
+func OpenQueue(file string) (*UploadQueue, error) {
+	q := &UploadQueue{
+		file: file,
+		keys: make(map[string]bool),
+	}
+	err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	err = q.compact()
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *UploadQueue) load() error {
+	f, err := os.Open(q.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Any partial line is an incomplete write.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var rec journalRecord
+		err = json.Unmarshal(line, &rec)
+		if err != nil {
+			return fmt.Errorf("%s: line %d: %v", q.file, n, err)
+		}
+		if rec.Seq > q.seq {
+			q.seq = rec.Seq
+		}
+		if rec.Done {
+			q.remove(rec.Seq)
+			continue
+		}
+		q.add(rec)
+	}
+}
+
+// compact rewrites the journal with only the pending uploads
+// and opens it for appending.
+func (q *UploadQueue) compact() error {
+	if q.f != nil {
+		q.f.Close()
+		q.f = nil
+	}
+	var buf bytes.Buffer
+	for _, rec := range q.pending {
+		err := writeRecord(&buf, rec)
+		if err != nil {
+			return err
+		}
+	}
+	tmp := q.file + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, q.file)
+	if err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(q.file))
+	q.f, err = os.OpenFile(q.file, os.O_WRONLY|os.O_APPEND, 0600)
+	return err
+}
+
+// syncDir makes a rename durable. Errors are ignored
+// because some platforms do not support syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
+
+func writeRecord(w io.Writer, rec journalRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// appendRecord writes a record to the journal and syncs it.
+func (q *UploadQueue) appendRecord(rec journalRecord) error {
+	if q.f == nil {
+		return fmt.Errorf("%s: upload queue is closed", q.file)
+	}
+	err := writeRecord(q.f, rec)
+	if err != nil {
+		return err
+	}
+	return q.f.Sync()
+}
+
+func (q *UploadQueue) add(rec journalRecord) {
+	q.pending = append(q.pending, rec)
+	for _, k := range recordKeys(rec.API, rec.Data) {
+		q.keys[k] = true
+	}
+}
+
+func (q *UploadQueue) remove(seq uint64) {
+	for i, rec := range q.pending {
+		if rec.Seq != seq {
+			continue
+		}
+		for _, k := range recordKeys(rec.API, rec.Data) {
+			delete(q.keys, k)
+		}
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		return
+	}
+}
+
+// Len returns the number of pending uploads.
+func (q *UploadQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Enqueue adds an upload to the queue.
+// Entries, treatments, and devicestatus records that are already pending
+// are dropped. Duplicates are identified by date and type for entries
+// (the fields that MergeEntries uses to order them), by created_at and eventType
+// for treatments, and by created_at and device for devicestatus records.
+func (q *UploadQueue) Enqueue(api string, data interface{}) error {
+	items, err := splitRecords(data)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var fresh []json.RawMessage
+	for _, item := range items {
+		k := recordKey(api, item)
+		if len(k) != 0 {
+			if q.keys[k] {
+				continue
+			}
+			// Also catch duplicates within this upload.
+			q.keys[k] = true
+		}
+		fresh = append(fresh, item)
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	array, err := json.Marshal(fresh)
+	if err != nil {
+		return err
+	}
+	rec := journalRecord{Seq: q.seq + 1, API: api, Data: array}
+	err = q.appendRecord(rec)
+	if err != nil {
+		for _, k := range recordKeys(api, array) {
+			delete(q.keys, k)
+		}
+		return err
+	}
+	q.seq++
+	q.pending = append(q.pending, rec)
+	return nil
+}
+
+// Flush uploads the pending records to the given website in order.
+// It stops at the first upload that fails with an error
+// other than a rejection by Nightscout.
+// Uploads rejected by Nightscout as invalid are logged and dropped,
+// since they would never succeed.
+func (q *UploadQueue) Flush(ctx context.Context, w *Website) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return nil
+	}
+	for len(q.pending) != 0 {
+		rec := q.pending[0]
+		err := w.restOperation(ctx, "POST", rec.API, rec.Data, nil)
+		if err != nil && (retryLater(err) || StatusCode(err) == 0) {
+			return err
+		}
+		if err != nil {
+			log.Printf("dropping queued upload to %s: %v", rec.API, err)
+		}
+		err = q.appendRecord(journalRecord{Seq: rec.Seq, Done: true})
+		if err != nil {
+			return err
+		}
+		q.remove(rec.Seq)
+	}
+	return q.compact()
+}
+
+// Close closes the journal file.
+func (q *UploadQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.f == nil {
+		return nil
+	}
+	err := q.f.Close()
+	q.f = nil
+	return err
+}
+
+// retryLater reports whether an upload that failed with the given error
+// might succeed later: either the request could not be sent or answered,
+// or Nightscout responded with a status indicating a temporary problem.
+// Other errors, such as a missing API secret or a canceled context,
+// are returned to the caller.
+func retryLater(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	code := StatusCode(err)
+	if code != 0 {
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// splitRecords converts data to a sequence of JSON records.
+func splitRecords(data interface{}) ([]json.RawMessage, error) {
+	raw, ok := data.(json.RawMessage)
+	if !ok {
+		var err error
+		raw, err = json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) != 0 && raw[0] == '[' {
+		var items []json.RawMessage
+		err := json.Unmarshal(raw, &items)
+		return items, err
+	}
+	return []json.RawMessage{raw}, nil
+}
+
+// Fields that identify duplicate records for each API.
+var duplicateFields = []struct {
+	api    string
+	fields []string
+}{
+	{"api/v1/entries", []string{"date", "type"}},
+	{"api/v1/treatments", []string{"created_at", "eventType"}},
+	{"api/v1/devicestatus", []string{"created_at", "device"}},
+}
+
+// recordKey returns a string identifying the record for duplicate detection,
+// or "" if the API has no such notion.
+func recordKey(api string, item json.RawMessage) string {
+	for _, d := range duplicateFields {
+		if !strings.HasPrefix(api, d.api) {
+			continue
+		}
+		var m map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(item))
+		dec.UseNumber()
+		if dec.Decode(&m) != nil {
+			return ""
+		}
+		k := d.api
+		for _, f := range d.fields {
+			k += fmt.Sprintf("|%v", m[f])
+		}
+		return k
+	}
+	return ""
+}
+
+func recordKeys(api string, data json.RawMessage) []string {
+	items, err := splitRecords(data)
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	for _, item := range items {
+		k := recordKey(api, item)
+		if len(k) != 0 {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Queue returns the upload queue, or nil if there is none.
+func (w *Website) Queue() *UploadQueue {
+	return w.queue
+}
+
+// SetQueue sets the upload queue.
+// When a queue is set, uploads that fail with a transient error
+// are added to the queue instead of returning the error,
+// and pending uploads are replayed before each new upload.
+func (w *Website) SetQueue(q *UploadQueue) {
+	w.queue = q
+}
+
+// FlushQueue uploads any pending records in the upload queue.
+func (w *Website) FlushQueue(ctx context.Context) error {
+	if w.queue == nil || w.noUpload {
+		return nil
+	}
+	return w.queue.Flush(ctx, w)
+}
@@ -0,0 +1,211 @@
+package nightscout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempQueue(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "journal"), func() { os.RemoveAll(dir) }
+}
+
+func TestQueueDurability(t *testing.T) {
+	file, cleanup := tempQueue(t)
+	defer cleanup()
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads := []struct {
+		api  string
+		data interface{}
+	}{
+		{"api/v1/entries", E[:3]},
+		// Duplicates of pending entries are dropped.
+		{"api/v1/entries", E[2:4]},
+		{"api/v1/entries", E[:1]},
+		{"api/v1/treatments", []Treatment{NewNote(T[0], "a"), NewNote(T[0], "b")}},
+		{"api/v1/devicestatus", DeviceStatus{CreatedAt: T[0], Device: "test"}},
+		{"api/v1/devicestatus", DeviceStatus{CreatedAt: T[1], Device: "test"}},
+	}
+	for _, u := range uploads {
+		err = q.Enqueue(u.api, u.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.Len() != 5 {
+		t.Errorf("Len() == %d, want 5", q.Len())
+	}
+	want := q.pending
+	err = q.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of writing a record.
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte(`{"seq":6,"api":"api/v1/entries","data":[{"type":"sgv","da`))
+	f.Close()
+
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if !reflect.DeepEqual(q.pending, want) {
+		t.Errorf("reopened queue contains %+v, want %+v", q.pending, want)
+	}
+	var entries Entries
+	_ = json.Unmarshal(q.pending[1].Data, &entries)
+	if !reflect.DeepEqual(entries, E[3:4]) {
+		t.Errorf("second upload contains %v, want %v", entries, E[3:4])
+	}
+	err = q.Enqueue("api/v1/entries", E[4:5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.pending[len(q.pending)-1].Seq != 6 {
+		t.Errorf("new upload has sequence number %d, want 6", q.pending[len(q.pending)-1].Seq)
+	}
+}
+
+func TestQueueUpload(t *testing.T) {
+	file, cleanup := tempQueue(t)
+	defer cleanup()
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	status := http.StatusServiceUnavailable
+	var received Entries
+	w, done := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			rw.WriteHeader(status)
+			return
+		}
+		var v Entries
+		_ = json.NewDecoder(r.Body).Decode(&v)
+		received = append(received, v...)
+	})
+	defer done()
+	w.SetQueue(q)
+	for i := 0; i < 3; i++ {
+		err = w.Upload("api/v1/entries", E[i:i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.Len() != 3 || len(received) != 0 {
+		t.Errorf("queued %d uploads and received %v, want 3 and none", q.Len(), received)
+	}
+	status = http.StatusOK
+	err = w.Upload("api/v1/entries", E[3:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 0 || !reflect.DeepEqual(received, E[:4]) {
+		t.Errorf("queued %d uploads and received %v, want 0 and %v", q.Len(), received, E[:4])
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("journal size is %d after flush, want 0", info.Size())
+	}
+	// Invalid uploads are not queued.
+	status = http.StatusBadRequest
+	err = w.Upload("api/v1/entries", E[4:5])
+	if StatusCode(err) != http.StatusBadRequest || q.Len() != 0 {
+		t.Errorf("Upload returned %v and queued %d uploads", err, q.Len())
+	}
+}
+
+func TestQueueUploadError(t *testing.T) {
+	file, cleanup := tempQueue(t)
+	defer cleanup()
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	status := http.StatusServiceUnavailable
+	w, done := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(status)
+	})
+	defer done()
+	w.SetQueue(q)
+	err = w.Upload("api/v1/entries", E[:1])
+	if err != nil || q.Len() != 1 {
+		t.Fatalf("Upload returned %v and queued %d uploads, want nil and 1", err, q.Len())
+	}
+	status = http.StatusOK
+
+	// Errors that will recur until the caller fixes them
+	// are neither queued nor allowed to drop pending uploads.
+	secret, hadSecret := os.LookupEnv(apiSecretEnvVar)
+	os.Unsetenv(apiSecretEnvVar)
+	defer func() {
+		if hadSecret {
+			os.Setenv(apiSecretEnvVar, secret)
+		}
+	}()
+	w.Token = ""
+	err = w.Upload("api/v1/entries", E[1:2])
+	if err == nil || StatusCode(err) != 0 || q.Len() != 1 {
+		t.Errorf("Upload without API secret returned %v and queued %d uploads, want error and 1", err, q.Len())
+	}
+	w.Token = "test-secret"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = w.UploadContext(ctx, "api/v1/entries", E[1:2])
+	if !errors.Is(err, context.Canceled) || q.Len() != 1 {
+		t.Errorf("Upload with canceled context returned %v and queued %d uploads, want %v and 1", err, q.Len(), context.Canceled)
+	}
+	err = w.Upload("api/v1/entries", E[1:2])
+	if err != nil || q.Len() != 0 {
+		t.Errorf("Upload returned %v and queued %d uploads, want nil and 0", err, q.Len())
+	}
+}
+
+func TestRetryLater(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&url.Error{Op: "Post", URL: "https://example.com", Err: errors.New("connection refused")}, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{&APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{&APIError{StatusCode: http.StatusBadGateway}, true},
+		{&APIError{StatusCode: http.StatusUnauthorized}, false},
+		{&APIError{StatusCode: http.StatusBadRequest}, false},
+		{fmt.Errorf("%s is not set", apiSecretEnvVar), false},
+		{&url.Error{Op: "Post", URL: "https://example.com", Err: context.Canceled}, false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, c := range cases {
+		got := retryLater(c.err)
+		if got != c.want {
+			t.Errorf("retryLater(%v) == %v, want %v", c.err, got, c.want)
+		}
+	}
+}
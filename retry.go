@@ -0,0 +1,180 @@
+package nightscout
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy specifies how failed Nightscout requests are retried.
+// The zero value performs a single attempt with no retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry.
+	// It doubles with each subsequent retry, up to MaxBackoff.
+	MinBackoff time.Duration
+	// MaxBackoff also limits the delay requested by a Retry-After header.
+	MaxBackoff time.Duration
+	// RetryableStatus lists the HTTP status codes that are retried.
+	RetryableStatus []int
+	// RetryPOST allows POST requests to be retried.
+	// Nightscout POST operations are not idempotent,
+	// so a retry may create duplicate records.
+	RetryPOST bool
+}
+
+// DefaultRetryPolicy is a reasonable policy for unreliable networks.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  time.Second,
+	MaxBackoff:  30 * time.Second,
+	RetryableStatus: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// RetryPolicy returns the retry policy.
+func (w *Website) RetryPolicy() RetryPolicy {
+	return w.retry
+}
+
+// SetRetryPolicy sets the retry policy.
+func (w *Website) SetRetryPolicy(p RetryPolicy) {
+	w.retry = p
+}
+
+// do performs the HTTP request returned by newRequest,
+// creating a new request for each attempt.
+func (p RetryPolicy) do(ctx context.Context, client *http.Client, verbose bool, newRequest func(attempt int) (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest(attempt)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if e, ok := err.(*url.Error); ok {
+			// Don't expose secrets in the URL.
+			err = &url.Error{Op: e.Op, URL: redactURL(req.URL), Err: e.Err}
+		}
+		if ctx.Err() != nil {
+			if err == nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		retry, wait := p.shouldRetry(req.Method, attempt, resp, err)
+		if !retry {
+			return resp, err
+		}
+		if err == nil {
+			err = newAPIError(resp)
+			resp.Body.Close()
+		}
+		if verbose {
+			log.Printf("%s %s: %v; retrying in %v", req.Method, redactURL(req.URL), err, wait)
+		}
+		err = sleep(ctx, wait)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// idempotent reports whether the operation can be repeated safely.
+func (p RetryPolicy) idempotent(op string) bool {
+	return op != "POST" || p.RetryPOST
+}
+
+func (p RetryPolicy) retryableStatus(code int) bool {
+	for _, c := range p.RetryableStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry determines whether the outcome of the given attempt should be retried,
+// and if so, how long to wait first.
+func (p RetryPolicy) shouldRetry(op string, attempt int, resp *http.Response, err error) (bool, time.Duration) {
+	if attempt >= p.MaxAttempts || !p.idempotent(op) {
+		return false, 0
+	}
+	if err != nil {
+		return true, p.backoff(attempt)
+	}
+	if !p.retryableStatus(resp.StatusCode) {
+		return false, 0
+	}
+	if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+		// Don't let the server delay the retry beyond the policy's limit.
+		if p.MaxBackoff > 0 && d > p.MaxBackoff {
+			d = p.MaxBackoff
+		}
+		return true, d
+	}
+	return true, p.backoff(attempt)
+}
+
+// backoff returns the delay before the given retry,
+// using exponential backoff with jitter.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// retryAfter parses the value of a Retry-After header,
+// which is either a number of seconds or an HTTP date.
+func retryAfter(s string) (time.Duration, bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 {
+			return 0, false
+		}
+		return time.Duration(n) * time.Second, true
+	}
+	t, err := http.ParseTime(s)
+	if err != nil {
+		return 0, false
+	}
+	d := time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// sleep waits for the given duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package nightscout
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	MinBackoff:      time.Millisecond,
+	MaxBackoff:      5 * time.Millisecond,
+	RetryableStatus: DefaultRetryPolicy.RetryableStatus,
+}
+
+func TestRetry(t *testing.T) {
+	cases := []struct {
+		op       string
+		failures int
+		status   int
+		policy   RetryPolicy
+		attempts int
+		ok       bool
+	}{
+		{"GET", 0, 0, testRetryPolicy, 1, true},
+		{"GET", 2, http.StatusServiceUnavailable, testRetryPolicy, 3, true},
+		{"GET", 3, http.StatusBadGateway, testRetryPolicy, 3, false},
+		{"GET", 1, http.StatusNotFound, testRetryPolicy, 1, false},
+		{"GET", 1, http.StatusServiceUnavailable, RetryPolicy{}, 1, false},
+		{"PUT", 1, http.StatusTooManyRequests, testRetryPolicy, 2, true},
+		{"POST", 1, http.StatusGatewayTimeout, testRetryPolicy, 1, false},
+	}
+	for _, c := range cases {
+		t.Run(c.op, func(t *testing.T) {
+			attempts := 0
+			w, cleanup := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+				attempts++
+				if attempts <= c.failures {
+					rw.Header().Set("Retry-After", "0")
+					rw.WriteHeader(c.status)
+					return
+				}
+				_, _ = rw.Write([]byte("[]"))
+			})
+			defer cleanup()
+			w.SetRetryPolicy(c.policy)
+			var err error
+			switch c.op {
+			case "GET":
+				err = w.Get("api/v1/entries", nil)
+			case "PUT":
+				err = w.Put("api/v1/profile", Profile{})
+			case "POST":
+				err = w.Upload("api/v1/entries", Entries{})
+			}
+			if attempts != c.attempts {
+				t.Errorf("%s made %d attempts, want %d", c.op, attempts, c.attempts)
+			}
+			if (err == nil) != c.ok {
+				t.Errorf("%s returned %v", c.op, err)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	cases := []struct {
+		header string
+		delay  time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.header, func(t *testing.T) {
+			d, ok := retryAfter(c.header)
+			if d != c.delay || ok != c.ok {
+				t.Errorf("retryAfter(%q) == %v, %v, want %v, %v", c.header, d, ok, c.delay, c.ok)
+			}
+		})
+	}
+}
+
+func TestRetryAfterLimit(t *testing.T) {
+	cases := []struct {
+		header string
+		policy RetryPolicy
+		wait   time.Duration
+	}{
+		{"0", testRetryPolicy, 0},
+		{"120", testRetryPolicy, testRetryPolicy.MaxBackoff},
+		{"120", RetryPolicy{MaxAttempts: 2, RetryableStatus: testRetryPolicy.RetryableStatus}, 2 * time.Minute},
+	}
+	for _, c := range cases {
+		t.Run(c.header, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": []string{c.header}},
+			}
+			retry, wait := c.policy.shouldRetry("GET", 1, resp, nil)
+			if !retry || wait != c.wait {
+				t.Errorf("shouldRetry with Retry-After %s == %v, %v, want true, %v", c.header, retry, wait, c.wait)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for attempt := 1; attempt <= 6; attempt++ {
+		max := time.Second << uint(attempt-1)
+		if max > p.MaxBackoff {
+			max = p.MaxBackoff
+		}
+		d := p.backoff(attempt)
+		if d < max/2 || d > max {
+			t.Errorf("backoff(%d) == %v, want between %v and %v", attempt, d, max/2, max)
+		}
+	}
+}
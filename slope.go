@@ -1,5 +1,11 @@
 package nightscout
 
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
 // Points is the interface satisfied by a set of points.
 type Points interface {
 	Len() int
@@ -13,34 +19,217 @@ type Line struct {
 	Intercept float64
 }
 
+// Regression is the type of functions that fit a line to a set of points,
+// such as FindLine, FindTheilSenLine, and FindHuberLine.
+type Regression func(Points) (Line, error)
+
 // FindLine performs simple linear regression on a set of points.
-func FindLine(points Points) Line {
+// It returns an error if there are fewer than 2 points
+// or all the points have the same x-coordinate.
+func FindLine(points Points) (Line, error) {
+	return FindWeightedLine(points, nil)
+}
+
+// FindWeightedLine performs weighted least-squares regression on a set of points.
+// The weight function returns the weight of point i;
+// if it is nil, all points have the same weight.
+func FindWeightedLine(points Points, weight func(i int) float64) (Line, error) {
 	n := points.Len()
 	if n < 2 {
-		panic("FindLine requires at least 2 points")
+		return Line{}, fmt.Errorf("linear regression requires at least 2 points")
 	}
-	xSum, xSqSum, ySum, ySqSum, xySum := 0.0, 0.0, 0.0, 0.0, 0.0
+	wSum, xSum, xSqSum, ySum, xySum := 0.0, 0.0, 0.0, 0.0, 0.0
+	distinct := false
 	for i := 0; i < n; i++ {
+		w := 1.0
+		if weight != nil {
+			w = weight(i)
+		}
 		x := points.X(i)
-		xSum += x
-		xSqSum += x * x
 		y := points.Y(i)
-		ySum += y
-		ySqSum += y * y
-		xySum += x * y
-	}
-	s := float64(n)
-	xBar := xSum / s
-	yBar := ySum / s
-	slope := (xySum - xSum*yBar) / (xSqSum - xSum*xBar)
+		if x != points.X(0) {
+			distinct = true
+		}
+		wSum += w
+		xSum += w * x
+		xSqSum += w * x * x
+		ySum += w * y
+		xySum += w * x * y
+	}
+	if !distinct {
+		return Line{}, fmt.Errorf("linear regression requires distinct x-coordinates")
+	}
+	if wSum <= 0 {
+		return Line{}, fmt.Errorf("linear regression requires positive weights")
+	}
+	xBar := xSum / wSum
+	yBar := ySum / wSum
+	d := xSqSum - xSum*xBar
+	if d <= 0 {
+		return Line{}, fmt.Errorf("linear regression is numerically unstable for these points")
+	}
+	slope := (xySum - xSum*yBar) / d
 	intercept := yBar - slope*xBar
 	return Line{
 		Slope:     slope,
 		Intercept: intercept,
+	}, nil
+}
+
+// RecencyWeights returns a weight function for FindWeightedLine
+// that gives the point with the largest x-coordinate a weight of 1
+// and halves the weight of other points every halfLife units before it.
+func RecencyWeights(points Points, halfLife float64) func(i int) float64 {
+	xMax := math.Inf(-1)
+	for i := 0; i < points.Len(); i++ {
+		xMax = math.Max(xMax, points.X(i))
+	}
+	return func(i int) float64 {
+		return math.Exp2(-(xMax - points.X(i)) / halfLife)
 	}
 }
 
+// RecencyWeighted returns a Regression that uses FindWeightedLine with RecencyWeights.
+// For entries, x-coordinates are in minutes.
+func RecencyWeighted(halfLife float64) Regression {
+	return func(points Points) (Line, error) {
+		return FindWeightedLine(points, RecencyWeights(points, halfLife))
+	}
+}
+
+// FindTheilSenLine fits a line using the Theil-Sen estimator:
+// the slope is the median of the slopes between all pairs of points
+// with different x-coordinates, so up to 29% of the points can be outliers.
+func FindTheilSenLine(points Points) (Line, error) {
+	n := points.Len()
+	var slopes []float64
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			dx := points.X(j) - points.X(i)
+			if dx != 0 {
+				slopes = append(slopes, (points.Y(j)-points.Y(i))/dx)
+			}
+		}
+	}
+	if len(slopes) == 0 {
+		return Line{}, fmt.Errorf("Theil-Sen regression requires at least 2 distinct x-coordinates")
+	}
+	slope := median(slopes)
+	intercepts := make([]float64, n)
+	for i := range intercepts {
+		intercepts[i] = points.Y(i) - slope*points.X(i)
+	}
+	return Line{
+		Slope:     slope,
+		Intercept: median(intercepts),
+	}, nil
+}
+
+const (
+	// huberK is the usual tuning constant for the Huber loss,
+	// in units of the residuals' standard deviation.
+	huberK = 1.345
+
+	huberIterations = 50
+	huberTolerance  = 1e-9
+)
+
+// FindHuberLine fits a line that minimizes the Huber loss,
+// which is quadratic for small residuals and linear for large ones,
+// using iteratively reweighted least squares.
+// Outliers therefore have less influence than in FindLine.
+func FindHuberLine(points Points) (Line, error) {
+	line, err := FindLine(points)
+	if err != nil {
+		return line, err
+	}
+	n := points.Len()
+	weights := make([]float64, n)
+	for iter := 0; iter < huberIterations; iter++ {
+		residuals := line.Residuals(points)
+		// Estimate the scale of the residuals from their median absolute deviation.
+		abs := make([]float64, n)
+		for i, r := range residuals {
+			abs[i] = math.Abs(r)
+		}
+		scale := median(abs) / 0.6745
+		if scale == 0 {
+			// Most of the points lie on the line.
+			return line, nil
+		}
+		c := huberK * scale
+		for i, r := range abs {
+			weights[i] = 1
+			if r > c {
+				weights[i] = c / r
+			}
+		}
+		next, err := FindWeightedLine(points, func(i int) float64 { return weights[i] })
+		if err != nil {
+			return line, err
+		}
+		done := math.Abs(next.Slope-line.Slope) <= huberTolerance*(1+math.Abs(line.Slope)) &&
+			math.Abs(next.Intercept-line.Intercept) <= huberTolerance*(1+math.Abs(line.Intercept))
+		line = next
+		if done {
+			break
+		}
+	}
+	return line, nil
+}
+
+func median(v []float64) float64 {
+	s := make([]float64, len(v))
+	copy(s, v)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
 // Eval evaluates a linear function at the given value.
 func (l Line) Eval(x float64) float64 {
 	return l.Slope*x + l.Intercept
 }
+
+// Residuals returns the differences between the y-coordinates of the points
+// and the values of the line.
+func (l Line) Residuals(points Points) []float64 {
+	r := make([]float64, points.Len())
+	for i := range r {
+		r[i] = points.Y(i) - l.Eval(points.X(i))
+	}
+	return r
+}
+
+// RSquared returns the coefficient of determination of the line for the points:
+// the fraction of the variance in the y-coordinates that it explains,
+// clamped to be at least 0.
+// It is 1 if the points all have the same y-coordinate and lie on the line.
+func (l Line) RSquared(points Points) float64 {
+	n := points.Len()
+	if n == 0 {
+		return 0
+	}
+	yBar := 0.0
+	for i := 0; i < n; i++ {
+		yBar += points.Y(i)
+	}
+	yBar /= float64(n)
+	ssRes, ssTot := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		r := points.Y(i) - l.Eval(points.X(i))
+		ssRes += r * r
+		d := points.Y(i) - yBar
+		ssTot += d * d
+	}
+	if ssTot == 0 {
+		if ssRes == 0 {
+			return 1
+		}
+		return 0
+	}
+	return math.Max(0, 1-ssRes/ssTot)
+}
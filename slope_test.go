@@ -56,7 +56,10 @@ func TestFindLine(t *testing.T) {
 	}
 	for _, c := range cases {
 		t.Run("", func(t *testing.T) {
-			line := FindLine(c.points)
+			line, err := FindLine(c.points)
+			if err != nil {
+				t.Fatal(err)
+			}
 			if !closeEnough(line.Slope, c.line.Slope) {
 				t.Errorf("FindLine: got Slope %v, want %v", line.Slope, c.line.Slope)
 			}
@@ -66,3 +69,119 @@ func TestFindLine(t *testing.T) {
 		})
 	}
 }
+
+func TestDegenerateLines(t *testing.T) {
+	cases := []IntPoints{
+		{nil, nil},
+		{[]int{1}, []int{1}},
+		{[]int{3, 3, 3}, []int{1, 2, 3}},
+	}
+	for _, p := range cases {
+		for name, f := range map[string]Regression{
+			"FindLine":         FindLine,
+			"FindTheilSenLine": FindTheilSenLine,
+			"FindHuberLine":    FindHuberLine,
+			"RecencyWeighted":  RecencyWeighted(10),
+		} {
+			_, err := f(p)
+			if err == nil {
+				t.Errorf("%s(%v) succeeded", name, p)
+			}
+		}
+	}
+	_, err := FindWeightedLine(points0, func(int) float64 { return 0 })
+	if err == nil {
+		t.Errorf("FindWeightedLine with zero weights succeeded")
+	}
+}
+
+// Entries every 5 minutes rising by 10 mg/dL,
+// with a compression low near the end.
+var compressionLow = IntPoints{
+	[]int{0, 5, 10, 15, 20, 25, 30},
+	[]int{100, 110, 120, 130, 140, 80, 160},
+}
+
+func TestRobustLines(t *testing.T) {
+	ols, err := FindLine(compressionLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(ols.Slope-2) < 0.1 {
+		t.Errorf("FindLine slope %v is unexpectedly close to 2", ols.Slope)
+	}
+	ts, err := FindTheilSenLine(compressionLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !closeEnough(ts.Slope, 2) || !closeEnough(ts.Intercept, 100) {
+		t.Errorf("FindTheilSenLine == %+v, want {2 100}", ts)
+	}
+	h, err := FindHuberLine(compressionLow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(h.Slope-2) > math.Abs(ols.Slope-2)/4 {
+		t.Errorf("FindHuberLine slope %v is not much closer to 2 than %v", h.Slope, ols.Slope)
+	}
+	// Ignoring the outlier gives the exact line.
+	w, err := FindWeightedLine(compressionLow, func(i int) float64 {
+		if i == 5 {
+			return 0
+		}
+		return 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !closeEnough(w.Slope, 2) || !closeEnough(w.Intercept, 100) {
+		t.Errorf("FindWeightedLine == %+v, want {2 100}", w)
+	}
+}
+
+func TestRecencyWeights(t *testing.T) {
+	weight := RecencyWeights(compressionLow, 10)
+	want := []float64{0.125, 0.25 / math.Sqrt2, 0.25, 0.5 / math.Sqrt2, 0.5, 1 / math.Sqrt2, 1}
+	for i, w := range want {
+		if !closeEnough(weight(i), w) {
+			t.Errorf("weight(%d) == %v, want %v", i, weight(i), w)
+		}
+	}
+	// Equal weights give the same result as FindLine.
+	for _, p := range []IntPoints{points0, points1, points2} {
+		line, _ := FindLine(p)
+		weighted, err := RecencyWeighted(math.Inf(1))(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if weighted != line {
+			t.Errorf("RecencyWeighted(+Inf) == %+v, want %+v", weighted, line)
+		}
+	}
+}
+
+func TestGoodnessOfFit(t *testing.T) {
+	line := Line{Slope: 2, Intercept: 100}
+	r := line.Residuals(compressionLow)
+	want := []float64{0, 0, 0, 0, 0, -70, 0}
+	for i := range want {
+		if !closeEnough(r[i], want[i]) {
+			t.Errorf("Residuals == %v, want %v", r, want)
+			break
+		}
+	}
+	if r2 := (Line{5, 50}).RSquared(points0); !closeEnough(r2, 1) {
+		t.Errorf("RSquared == %v, want 1", r2)
+	}
+	// The outlier makes this line a worse fit than the mean.
+	if r2 := line.RSquared(compressionLow); r2 != 0 {
+		t.Errorf("RSquared == %v, want 0", r2)
+	}
+	// Least squares maximizes R².
+	ols, _ := FindLine(compressionLow)
+	h, _ := FindHuberLine(compressionLow)
+	r2, hr2 := ols.RSquared(compressionLow), h.RSquared(compressionLow)
+	if r2 <= 0 || r2 >= 1 || hr2 > r2 {
+		t.Errorf("RSquared == %v for FindLine and %v for FindHuberLine", r2, hr2)
+	}
+}
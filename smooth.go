@@ -0,0 +1,390 @@
+package nightscout
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Noise levels, as reported by Dexcom receivers and xDrip.
+const (
+	NoiseClean  = 1
+	NoiseLight  = 2
+	NoiseMedium = 3
+	NoiseHeavy  = 4
+)
+
+const (
+	// smoothGap is the longest gap between readings that are smoothed together.
+	smoothGap = 15 * time.Minute
+
+	// noiseWindow is the number of readings used to estimate noise.
+	noiseWindow = 5
+
+	// defaultRawSlope is a typical calibration slope, in raw units per mg/dL,
+	// used to estimate noise from raw values when there is no calibration.
+	defaultRawSlope = 1000
+)
+
+// Upper limits of the standard deviation, in mg/dL, from a local quadratic fit
+// for the Clean, Light, and Medium noise levels.
+var noiseLimits = [3]float64{3, 6, 12}
+
+// Smoother is the interface satisfied by smoothing filters.
+type Smoother interface {
+	// Smooth returns the smoothed values of y at times t,
+	// which are in minutes and in increasing order.
+	Smooth(t, y []float64) []float64
+}
+
+// KalmanFilter is a Smoother that tracks glucose and its rate of change.
+// It only uses past values, so it can be applied to readings as they arrive.
+type KalmanFilter struct {
+	// ProcessNoise is the variance of the change in rate of change per minute,
+	// in (mg/dL/min)² per minute. Smaller values give smoother output.
+	ProcessNoise float64
+	// MeasurementNoise is the variance of sensor readings, in (mg/dL)².
+	MeasurementNoise float64
+}
+
+// DefaultKalmanFilter is suitable for 5-minute CGM readings.
+var DefaultKalmanFilter = KalmanFilter{
+	ProcessNoise:     0.01,
+	MeasurementNoise: 16,
+}
+
+// Smooth implements the Smoother interface.
+func (k KalmanFilter) Smooth(t, y []float64) []float64 {
+	out := make([]float64, len(y))
+	if len(y) == 0 {
+		return out
+	}
+	q, r := k.ProcessNoise, k.MeasurementNoise
+	// State is glucose g and rate v, with covariance P.
+	g, v := y[0], 0.0
+	p00, p01, p11 := r, 0.0, 1.0
+	out[0] = g
+	for i := 1; i < len(y); i++ {
+		dt := t[i] - t[i-1]
+		// Predict.
+		g += v * dt
+		p00 += dt*(2*p01+dt*p11) + q*dt*dt*dt/3
+		p01 += dt*p11 + q*dt*dt/2
+		p11 += q * dt
+		// Update.
+		s := p00 + r
+		k0, k1 := p00/s, p01/s
+		e := y[i] - g
+		g += k0 * e
+		v += k1 * e
+		p00, p01, p11 = (1-k0)*p00, (1-k0)*p01, p11-k1*p01
+		out[i] = g
+	}
+	return out
+}
+
+// SavitzkyGolay is a Smoother that fits a polynomial to the readings
+// around each one. It uses future readings, so recent values
+// are less smoothed than older ones.
+// Irregularly spaced readings are fitted at their actual times.
+type SavitzkyGolay struct {
+	// Window is the number of readings in each fit, usually odd.
+	Window int
+	// Order is the degree of the polynomial, which must be less than Window.
+	Order int
+}
+
+// DefaultSavitzkyGolay fits quadratics to 7 readings.
+var DefaultSavitzkyGolay = SavitzkyGolay{Window: 7, Order: 2}
+
+// Smooth implements the Smoother interface.
+func (sg SavitzkyGolay) Smooth(t, y []float64) []float64 {
+	out := make([]float64, len(y))
+	for i := range y {
+		out[i] = y[i]
+		lo, hi := window(i, len(y), sg.Window)
+		c, err := polyFit(t[lo:hi], y[lo:hi], t[i], sg.Order)
+		if err == nil {
+			out[i] = c[0]
+		}
+	}
+	return out
+}
+
+// ExponentialSmoothing is a Smoother that computes an exponentially weighted
+// moving average. It only uses past values, but lags behind rising
+// or falling glucose.
+type ExponentialSmoothing struct {
+	// Alpha is the weight, between 0 and 1, of a new reading
+	// 5 minutes after the previous one.
+	// Readings at other intervals are weighted accordingly.
+	Alpha float64
+}
+
+// DefaultExponentialSmoothing gives equal weight to a new reading and the previous average.
+var DefaultExponentialSmoothing = ExponentialSmoothing{Alpha: 0.5}
+
+// Smooth implements the Smoother interface.
+func (es ExponentialSmoothing) Smooth(t, y []float64) []float64 {
+	out := make([]float64, len(y))
+	for i := range y {
+		if i == 0 {
+			out[i] = y[i]
+			continue
+		}
+		a := 1 - math.Pow(1-es.Alpha, (t[i]-t[i-1])/5)
+		out[i] = a*y[i] + (1-a)*out[i-1]
+	}
+	return out
+}
+
+// Smooth returns a copy of the entries with the glucose values of SGV entries
+// replaced by smoothed values. For entries with raw sensor values,
+// the Filtered field is set to the smoothed Unfiltered value if it is not already present.
+// The Noise field is set for entries that do not already have a noise level,
+// using the raw values of entries without glucose values.
+// Readings separated by gaps of more than 15 minutes are smoothed separately.
+// The entries must be in reverse chronological order.
+func (e Entries) Smooth(s Smoother) Entries {
+	v := make(Entries, len(e))
+	copy(v, e)
+	levels := e.NoiseLevels()
+	for i := range v {
+		if v[i].Noise == 0 {
+			v[i].Noise = levels[i]
+		}
+	}
+	for _, seg := range v.segments() {
+		sgv := v.series(seg, func(x *Entry) *int { return &x.SGV })
+		sgv.apply(v, s.Smooth(sgv.t, sgv.y))
+		raw := v.series(seg, func(x *Entry) *int { return &x.Unfiltered })
+		filtered := s.Smooth(raw.t, raw.y)
+		for i, j := range raw.index {
+			x := &v[j]
+			if x.Filtered == 0 {
+				x.Filtered = int(math.Round(filtered[i]))
+			}
+		}
+	}
+	return v
+}
+
+// NoiseLevels returns the estimated noise level of each entry,
+// or 0 for entries that are not SGV entries or have too few neighbors.
+// The noise of entries without glucose values is estimated from their raw values,
+// converted to mg/dL using the slope of the most recent calibration entry,
+// or a typical slope if there is none.
+// The entries must be in reverse chronological order.
+func (e Entries) NoiseLevels() []int {
+	levels := make([]int, len(e))
+	var scales []float64
+	for _, seg := range e.segments() {
+		sgv := e.series(seg, func(x *Entry) *int { return &x.SGV })
+		for i, n := range noiseLevels(sgv.t, sgv.y) {
+			levels[sgv.index[i]] = n
+		}
+		if len(sgv.index) == len(seg) {
+			continue
+		}
+		if scales == nil {
+			scales = e.rawScales()
+		}
+		raw := e.series(seg, func(x *Entry) *int { return &x.Unfiltered })
+		for i, j := range raw.index {
+			raw.y[i] *= scales[j]
+		}
+		for i, n := range noiseLevels(raw.t, raw.y) {
+			j := raw.index[i]
+			if e[j].SGV == 0 {
+				levels[j] = n
+			}
+		}
+	}
+	return levels
+}
+
+// rawScales returns the factor that converts the raw values of each entry to mg/dL,
+// ignoring the intercept, from the most recent calibration entry at or before it.
+func (e Entries) rawScales() []float64 {
+	scales := make([]float64, len(e))
+	scale := 1.0 / defaultRawSlope
+	for i := len(e) - 1; i >= 0; i-- {
+		x := e[i]
+		if x.Type == CalType && x.Slope != 0 && x.Scale != 0 {
+			scale = x.Scale / x.Slope
+		}
+		scales[i] = scale
+	}
+	return scales
+}
+
+// segments returns the indexes of SGV entries in chronological order,
+// divided where there are gaps.
+func (e Entries) segments() [][]int {
+	var segs [][]int
+	var cur []int
+	for i := len(e) - 1; i >= 0; i-- {
+		if e[i].Type != SGVType {
+			continue
+		}
+		if len(cur) != 0 && e[i].Time().Sub(e[cur[len(cur)-1]].Time()) > smoothGap {
+			segs = append(segs, cur)
+			cur = nil
+		}
+		cur = append(cur, i)
+	}
+	if len(cur) != 0 {
+		segs = append(segs, cur)
+	}
+	return segs
+}
+
+// series represents the nonzero values of a field in a segment of entries.
+type series struct {
+	index []int
+	t     []float64
+	y     []float64
+	field func(*Entry) *int
+}
+
+func (e Entries) series(seg []int, field func(*Entry) *int) series {
+	s := series{field: field}
+	for _, i := range seg {
+		y := *field(&e[i])
+		if y == 0 {
+			continue
+		}
+		s.index = append(s.index, i)
+		s.t = append(s.t, e[i].Time().Sub(e[seg[0]].Time()).Minutes())
+		s.y = append(s.y, float64(y))
+	}
+	return s
+}
+
+// apply stores smoothed values in the entries.
+func (s series) apply(e Entries, values []float64) {
+	for i, j := range s.index {
+		*s.field(&e[j]) = int(math.Round(values[i]))
+	}
+}
+
+// noiseLevels estimates the noise level of each value from the standard deviation
+// of the values around it from a quadratic fitted to them.
+func noiseLevels(t, y []float64) []int {
+	levels := make([]int, len(y))
+	if len(y) < noiseWindow {
+		return levels
+	}
+	for i := range y {
+		lo, hi := window(i, len(y), noiseWindow)
+		c, err := polyFit(t[lo:hi], y[lo:hi], t[i], 2)
+		if err != nil {
+			continue
+		}
+		ss := 0.0
+		for j := lo; j < hi; j++ {
+			r := y[j] - evalPoly(c, t[j]-t[i])
+			ss += r * r
+		}
+		// Divide by the degrees of freedom for an unbiased estimate.
+		levels[i] = noiseLevel(math.Sqrt(ss / float64(hi-lo-3)))
+	}
+	return levels
+}
+
+func noiseLevel(rms float64) int {
+	for i, limit := range noiseLimits {
+		if rms < limit {
+			return NoiseClean + i
+		}
+	}
+	return NoiseHeavy
+}
+
+// window returns the bounds of a window of n values centered on i,
+// shifted as needed to lie within [0, length).
+func window(i int, length int, n int) (int, int) {
+	if n > length {
+		n = length
+	}
+	lo := i - n/2
+	if lo < 0 {
+		lo = 0
+	}
+	hi := lo + n
+	if hi > length {
+		hi = length
+		lo = hi - n
+	}
+	return lo, hi
+}
+
+// polyFit returns the coefficients, constant term first, of the polynomial
+// of the given order in (t - t0) that best fits the points in the least-squares sense.
+func polyFit(t, y []float64, t0 float64, order int) ([]float64, error) {
+	n := order + 1
+	if len(t) < n {
+		return nil, fmt.Errorf("polynomial of order %d requires at least %d points", order, n)
+	}
+	// Build the augmented normal equations.
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+	for k := range t {
+		x := t[k] - t0
+		pow := make([]float64, 2*n)
+		pow[0] = 1
+		for j := 1; j < len(pow); j++ {
+			pow[j] = pow[j-1] * x
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a[i][j] += pow[i+j]
+			}
+			a[i][n] += pow[i] * y[k]
+		}
+	}
+	return solve(a)
+}
+
+// solve solves a system of linear equations, represented as an augmented matrix,
+// using Gaussian elimination with partial pivoting.
+func solve(a [][]float64) ([]float64, error) {
+	n := len(a)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("singular matrix")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for j := col; j <= n; j++ {
+				a[row][j] -= f * a[col][j]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := a[row][n]
+		for j := row + 1; j < n; j++ {
+			sum -= a[row][j] * x[j]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x, nil
+}
+
+func evalPoly(c []float64, x float64) float64 {
+	v := 0.0
+	for i := len(c) - 1; i >= 0; i-- {
+		v = v*x + c[i]
+	}
+	return v
+}
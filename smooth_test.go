@@ -0,0 +1,159 @@
+package nightscout
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// alternating returns SGV entries that rise by the given rate in mg/dL/min
+// with deviations of ±d, most recent first.
+func alternating(n int, rate int, d int) Entries {
+	bgs := make([]int, n)
+	for i := range bgs {
+		bgs[i] = 200 - 5*rate*i
+		if i%2 == 1 {
+			bgs[i] += d
+		} else {
+			bgs[i] -= d
+		}
+	}
+	return sgvEntries(bgs...)
+}
+
+func deviation(e Entries) float64 {
+	ss := 0.0
+	for _, x := range e {
+		r := float64(x.SGV - 200)
+		ss += r * r
+	}
+	return math.Sqrt(ss / float64(len(e)))
+}
+
+func TestSmoothers(t *testing.T) {
+	smoothers := map[string]Smoother{
+		"Kalman":               DefaultKalmanFilter,
+		"SavitzkyGolay":        DefaultSavitzkyGolay,
+		"ExponentialSmoothing": DefaultExponentialSmoothing,
+	}
+	noisy := alternating(24, 0, 6)
+	for name, s := range smoothers {
+		t.Run(name, func(t *testing.T) {
+			v := noisy.Smooth(s)
+			if len(v) != len(noisy) || noisy[0].SGV != 194 {
+				t.Fatalf("Smooth modified its argument or returned %d entries", len(v))
+			}
+			// Skip the oldest entries, where the filters start up.
+			before, after := deviation(noisy[:16]), deviation(v[:16])
+			if after >= before/2 {
+				t.Errorf("RMS deviation is %.2f after smoothing, %.2f before", after, before)
+			}
+			constant := sgvEntries(120, 120, 120, 120, 120, 120, 120).Smooth(s)
+			for _, x := range constant {
+				if x.SGV != 120 || x.Noise != NoiseClean {
+					t.Errorf("smoothing constant values gave %d with noise %d", x.SGV, x.Noise)
+					break
+				}
+			}
+		})
+	}
+	// Savitzky-Golay preserves lines and quadratics exactly.
+	linear := alternating(12, 1, 0)
+	v := linear.Smooth(DefaultSavitzkyGolay)
+	for i := range v {
+		if v[i].SGV != linear[i].SGV {
+			t.Errorf("SavitzkyGolay changed %d to %d", linear[i].SGV, v[i].SGV)
+		}
+	}
+}
+
+func TestNoiseLevels(t *testing.T) {
+	cases := []struct {
+		d     int
+		noise int
+	}{
+		{0, NoiseClean},
+		{3, NoiseLight},
+		{6, NoiseMedium},
+		{15, NoiseHeavy},
+	}
+	for _, c := range cases {
+		levels := alternating(12, 1, c.d).NoiseLevels()
+		// Noise estimates at the ends are less reliable.
+		for i, n := range levels[2:10] {
+			if n != c.noise {
+				t.Errorf("deviation ±%d: noise level %d == %d, want %d", c.d, i+2, n, c.noise)
+			}
+		}
+	}
+	if levels := sgvEntries(100, 110, 120).NoiseLevels(); levels[0] != 0 {
+		t.Errorf("noise levels for 3 entries == %v, want 0", levels)
+	}
+}
+
+func TestSmoothRaw(t *testing.T) {
+	e := alternating(12, 1, 6)
+	// Insert a calibration, which should be ignored.
+	e = append(e[:6], append(Entries{{Type: CalType, Date: e[5].Date - 1}}, e[6:]...)...)
+	for i := range e {
+		if e[i].Type == SGVType {
+			e[i].Unfiltered = 1000 * e[i].SGV
+			e[i].SGV = 0
+		}
+	}
+	e[0].Filtered = 1
+	v := e.Smooth(DefaultKalmanFilter)
+	for i, x := range v {
+		switch {
+		case x.Type != SGVType:
+			if x != e[i] {
+				t.Errorf("Smooth modified %v entry", x.Type)
+			}
+		case x.SGV != 0:
+			t.Errorf("Smooth set SGV %d without glucose values", x.SGV)
+		case x.Noise != NoiseMedium && i >= 2 && i <= 10:
+			// With the default slope, the raw deviations are ±6 mg/dL.
+			t.Errorf("Smooth set noise level %d from raw values, want %d", x.Noise, NoiseMedium)
+		case x.Noise == 0:
+			t.Errorf("Smooth did not set noise level from raw values")
+		case i == 0 && x.Filtered != 1:
+			t.Errorf("Smooth replaced filtered value %d", e[i].Filtered)
+		case i != 0 && (x.Filtered == 0 || math.Abs(float64(x.Filtered-x.Unfiltered)) > 6000):
+			t.Errorf("Smooth set filtered value %d for unfiltered value %d", x.Filtered, x.Unfiltered)
+		}
+	}
+}
+
+func TestRawNoiseLevels(t *testing.T) {
+	e := alternating(12, 1, 6)
+	for i := range e {
+		e[i].Unfiltered = 1000 * e[i].SGV
+		e[i].SGV = 0
+	}
+	// A calibration slope of 2000 halves the deviations of ±6 mg/dL
+	// at the default slope.
+	cal := Entry{Type: CalType, Date: e[len(e)-1].Date - 1, Slope: 2000, Intercept: 30000, Scale: 1}
+	levels := append(e, cal).NoiseLevels()
+	for i, n := range levels[2:10] {
+		if n != NoiseLight {
+			t.Errorf("noise level %d == %d, want %d", i+2, n, NoiseLight)
+		}
+	}
+	if levels[len(levels)-1] != 0 {
+		t.Errorf("calibration entry has noise level %d", levels[len(levels)-1])
+	}
+}
+
+func TestSmoothGaps(t *testing.T) {
+	e := sgvEntries(100, 100, 100, 100, 100)
+	later := sgvEntries(200, 200, 200)
+	for i := range later {
+		later[i].Date += Date(time.Unix(0, 0).Add(time.Hour))
+	}
+	v := append(later, e...).Smooth(DefaultExponentialSmoothing)
+	for _, x := range v {
+		if x.SGV != 100 && x.SGV != 200 {
+			t.Errorf("smoothing across a gap gave %d", x.SGV)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+// AGPPercentiles are the percentiles shown in an Ambulatory Glucose Profile.
+var AGPPercentiles = []float64{5, 25, 50, 75, 95}
+
+// AGPBin holds the distribution of glucose values during a time of day.
+type AGPBin struct {
+	// Start is the beginning of the bin, as an offset from midnight.
+	Start time.Duration
+	// Count is the number of readings in the bin.
+	Count int
+	// Percentiles holds the glucose value at each of AGPPercentiles,
+	// or NaN if there are no readings in the bin.
+	Percentiles []float64
+}
+
+// AGP computes an Ambulatory Glucose Profile: the entries are grouped
+// into bins of the given width by their time of day in loc,
+// regardless of date, and AGPPercentiles are computed for each bin.
+// The width should divide 24 hours evenly, and must be positive.
+func AGP(entries nightscout.Entries, width time.Duration, loc *time.Location) ([]AGPBin, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("invalid AGP bin width %v", width)
+	}
+	n := int((24*time.Hour + width - 1) / width)
+	groups := make([][]float64, n)
+	for _, r := range readings(entries) {
+		i := int(timeOfDay(r.t.In(loc)) / width)
+		groups[i] = append(groups[i], r.bg)
+	}
+	bins := make([]AGPBin, n)
+	for i, v := range groups {
+		sort.Float64s(v)
+		p := make([]float64, len(AGPPercentiles))
+		for j, pct := range AGPPercentiles {
+			p[j] = percentile(v, pct)
+		}
+		bins[i] = AGPBin{
+			Start:       time.Duration(i) * width,
+			Count:       len(v),
+			Percentiles: p,
+		}
+	}
+	return bins, nil
+}
+
+// timeOfDay returns the time since midnight.
+func timeOfDay(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(t.Nanosecond())
+}
+
+// percentile returns the pth percentile of the sorted values,
+// interpolating linearly between them.
+func percentile(sorted []float64, p float64) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return math.NaN()
+	}
+	x := p / 100 * float64(n-1)
+	i := int(math.Floor(x))
+	if i >= n-1 {
+		return sorted[n-1]
+	}
+	f := x - float64(i)
+	return sorted[i] + f*(sorted[i+1]-sorted[i])
+}
@@ -0,0 +1,82 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+func TestAGP(t *testing.T) {
+	var entries nightscout.Entries
+	for d, bg := range []int{100, 300, 200} {
+		day := testStart.Add(time.Duration(d) * 24 * time.Hour)
+		entries = append(entries, sgvEntry(day.Add(90*time.Minute), bg))
+		entries = append(entries, sgvEntry(day.Add(23*time.Hour+55*time.Minute), 150))
+	}
+	bins, err := AGP(entries, time.Hour, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bins) != 24 {
+		t.Fatalf("AGP returned %d bins, want 24", len(bins))
+	}
+	b := bins[1]
+	if b.Start != time.Hour || b.Count != 3 {
+		t.Errorf("bin 1 starts at %v with %d readings, want 1h0m0s and 3", b.Start, b.Count)
+	}
+	want := []float64{110, 150, 200, 250, 290}
+	for i := range want {
+		if !closeTo(b.Percentiles[i], want[i], 1e-9) {
+			t.Errorf("percentile %v == %v, want %v", AGPPercentiles[i], b.Percentiles[i], want[i])
+		}
+	}
+	if bins[23].Count != 3 || bins[23].Percentiles[0] != 150 {
+		t.Errorf("bin 23 == %+v", bins[23])
+	}
+	if bins[0].Count != 0 || !math.IsNaN(bins[0].Percentiles[2]) {
+		t.Errorf("bin 0 == %+v, want no readings", bins[0])
+	}
+	// The same readings fall in different bins in another time zone.
+	bins, err = AGP(entries, time.Hour, time.FixedZone("UTC-2", -2*60*60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bins[23].Count != 3 || bins[21].Count != 3 {
+		t.Errorf("AGP in UTC-2 has %d and %d readings in bins 23 and 21, want 3 and 3", bins[23].Count, bins[21].Count)
+	}
+}
+
+func TestAGPWidth(t *testing.T) {
+	entries := nightscout.Entries{sgvEntry(testStart, 100)}
+	for _, width := range []time.Duration{0, -time.Hour} {
+		_, err := AGP(entries, width, time.UTC)
+		if err == nil {
+			t.Errorf("AGP with width %v succeeded", width)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	v := []float64{1, 2, 3, 4, 5}
+	cases := []struct {
+		p   float64
+		val float64
+	}{
+		{0, 1},
+		{25, 2},
+		{50, 3},
+		{90, 4.6},
+		{100, 5},
+	}
+	for _, c := range cases {
+		val := percentile(v, c.p)
+		if !closeTo(val, c.val, 1e-9) {
+			t.Errorf("percentile(%v) == %v, want %v", c.p, val, c.val)
+		}
+	}
+	if !math.IsNaN(percentile(nil, 50)) {
+		t.Errorf("percentile of no values is not NaN")
+	}
+}
@@ -0,0 +1,70 @@
+package stats
+
+import (
+	"math"
+
+	"github.com/ecc1/nightscout"
+)
+
+// Band is a range of glucose values, from Low (inclusive) to High (exclusive), in mg/dL.
+// The highest band in a set of bands usually has a High value of math.MaxInt32.
+type Band struct {
+	Name string
+	Low  int
+	High int
+}
+
+// Contains reports whether the band includes the glucose value.
+func (b Band) Contains(bg float64) bool {
+	return float64(b.Low) <= bg && bg < float64(b.High)
+}
+
+// noLimit is used as the upper limit of the highest band.
+const noLimit = math.MaxInt32
+
+// ConsensusBands are the ranges recommended by the International Consensus on Time in Range.
+var ConsensusBands = []Band{
+	{"very low", 0, 54},
+	{"low", 54, 70},
+	{"in range", 70, 181},
+	{"high", 181, 251},
+	{"very high", 251, noLimit},
+}
+
+// TightBands use the tighter target range of 70-140 mg/dL.
+var TightBands = []Band{
+	{"very low", 0, 54},
+	{"low", 54, 70},
+	{"in range", 70, 141},
+	{"high", 141, 181},
+	{"very high", 181, noLimit},
+}
+
+// TimeInRange returns the fraction, from 0 to 1, of readings in each band.
+// The bands need not be contiguous or cover all glucose values.
+func TimeInRange(entries nightscout.Entries, bands []Band) []float64 {
+	return timeInRange(values(readings(entries)), bands)
+}
+
+func timeInRange(v []float64, bands []Band) []float64 {
+	frac := make([]float64, len(bands))
+	for i, b := range bands {
+		if len(v) == 0 {
+			frac[i] = math.NaN()
+			continue
+		}
+		n := 0
+		for _, bg := range v {
+			if b.Contains(bg) {
+				n++
+			}
+		}
+		frac[i] = float64(n) / float64(len(v))
+	}
+	return frac
+}
+
+// fractionIn returns the fraction of values in [low, high).
+func fractionIn(v []float64, low, high int) float64 {
+	return timeInRange(v, []Band{{Low: low, High: high}})[0]
+}
@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"math"
+
+	"github.com/ecc1/nightscout"
+)
+
+// LBGI returns the Low Blood Glucose Index of Kovatchev et al.,
+// which measures the frequency and extent of low glucose values.
+// Values above 5 indicate a high risk of hypoglycemia.
+func LBGI(entries nightscout.Entries) float64 {
+	return lbgi(values(readings(entries)))
+}
+
+// HBGI returns the High Blood Glucose Index of Kovatchev et al.,
+// which measures the frequency and extent of high glucose values.
+// Values above 9 indicate a high risk of hyperglycemia.
+func HBGI(entries nightscout.Entries) float64 {
+	return hbgi(values(readings(entries)))
+}
+
+// bgRisk returns the symmetrized risk of a glucose value in mg/dL.
+// It is negative for low values and positive for high values.
+func bgRisk(bg float64) float64 {
+	return 1.509 * (math.Pow(math.Log(bg), 1.084) - 5.381)
+}
+
+func lbgi(v []float64) float64 {
+	return riskIndex(v, func(f float64) bool { return f < 0 })
+}
+
+func hbgi(v []float64) float64 {
+	return riskIndex(v, func(f float64) bool { return f > 0 })
+}
+
+func riskIndex(v []float64, include func(float64) bool) float64 {
+	if len(v) == 0 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, bg := range v {
+		f := bgRisk(bg)
+		if include(f) {
+			sum += 10 * f * f
+		}
+	}
+	return sum / float64(len(v))
+}
+
+// GRI returns the Glycemia Risk Index of Klonoff et al., from 0 to 100,
+// which weights time in the consensus ranges by their clinical risk.
+func GRI(entries nightscout.Entries) float64 {
+	return gri(values(readings(entries)))
+}
+
+func gri(v []float64) float64 {
+	pct := func(low, high int) float64 { return 100 * fractionIn(v, low, high) }
+	hypo := pct(0, 54) + 0.8*pct(54, 70)
+	hyper := pct(251, noLimit) + 0.5*pct(181, 251)
+	return math.Min(3*hypo+1.6*hyper, 100)
+}
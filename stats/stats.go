@@ -0,0 +1,168 @@
+// Package stats computes clinical glucose metrics from Nightscout entries.
+//
+// Only SGV entries with valid glucose values are used;
+// other entries and special sensor codes below 39 mg/dL are ignored.
+// Metrics are computed from the readings themselves rather than
+// weighted by time, so they assume readings at regular intervals.
+// Functions return NaN when there are too few readings.
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+// minGlucose is the lowest glucose value that is a sensor reading.
+// Lower values are error codes.
+const minGlucose = 39
+
+// reading is a glucose value in mg/dL at a given time.
+type reading struct {
+	t  time.Time
+	bg float64
+}
+
+// readings returns the glucose readings in the entries in chronological order.
+func readings(entries nightscout.Entries) []reading {
+	var r []reading
+	for _, e := range entries {
+		if e.Type != nightscout.SGVType || e.SGV < minGlucose {
+			continue
+		}
+		r = append(r, reading{t: e.Time(), bg: float64(e.SGV)})
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].t.Before(r[j].t) })
+	return r
+}
+
+func values(r []reading) []float64 {
+	v := make([]float64, len(r))
+	for i := range r {
+		v[i] = r[i].bg
+	}
+	return v
+}
+
+// Mean returns the mean glucose value in mg/dL.
+func Mean(entries nightscout.Entries) float64 {
+	return mean(values(readings(entries)))
+}
+
+// SD returns the standard deviation of glucose values in mg/dL.
+func SD(entries nightscout.Entries) float64 {
+	return sd(values(readings(entries)))
+}
+
+// CV returns the coefficient of variation of glucose values, as a percentage.
+func CV(entries nightscout.Entries) float64 {
+	v := values(readings(entries))
+	return cv(v)
+}
+
+// GMI returns the Glucose Management Indicator, an estimate of HbA1c
+// as a percentage, from the mean glucose value.
+func GMI(entries nightscout.Entries) float64 {
+	return gmi(Mean(entries))
+}
+
+// EA1c returns the estimated A1c as a percentage,
+// using the ADAG formula relating it to mean glucose.
+func EA1c(entries nightscout.Entries) float64 {
+	return eA1c(Mean(entries))
+}
+
+func mean(v []float64) float64 {
+	if len(v) == 0 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+// sd returns the sample standard deviation.
+func sd(v []float64) float64 {
+	if len(v) < 2 {
+		return math.NaN()
+	}
+	m := mean(v)
+	ss := 0.0
+	for _, x := range v {
+		d := x - m
+		ss += d * d
+	}
+	return math.Sqrt(ss / float64(len(v)-1))
+}
+
+func cv(v []float64) float64 {
+	return 100 * sd(v) / mean(v)
+}
+
+func gmi(mean float64) float64 {
+	return 3.31 + 0.02392*mean
+}
+
+func eA1c(mean float64) float64 {
+	return (mean + 46.7) / 28.7
+}
+
+// Summary holds the metrics for a set of entries.
+type Summary struct {
+	Start    time.Time
+	End      time.Time
+	Readings int
+
+	Mean float64
+	SD   float64
+	CV   float64
+	GMI  float64
+	EA1c float64
+
+	// TimeInRange holds the fraction of readings in each band.
+	Bands       []Band
+	TimeInRange []float64
+
+	MAGE  float64
+	MODD  float64
+	CONGA float64 // with a lag of 1 hour
+
+	LBGI float64
+	HBGI float64
+	GRI  float64
+}
+
+// Summarize computes all the metrics for the entries,
+// using the given bands for time in range.
+// It returns an error if there are fewer than 2 readings.
+func Summarize(entries nightscout.Entries, bands []Band) (Summary, error) {
+	r := readings(entries)
+	if len(r) < 2 {
+		return Summary{}, fmt.Errorf("not enough glucose values (%d)", len(r))
+	}
+	v := values(r)
+	s := Summary{
+		Start:       r[0].t,
+		End:         r[len(r)-1].t,
+		Readings:    len(r),
+		Mean:        mean(v),
+		SD:          sd(v),
+		CV:          cv(v),
+		Bands:       bands,
+		TimeInRange: timeInRange(v, bands),
+		MAGE:        mage(v),
+		MODD:        modd(r),
+		CONGA:       conga(r, time.Hour),
+		LBGI:        lbgi(v),
+		HBGI:        hbgi(v),
+		GRI:         gri(v),
+	}
+	s.GMI = gmi(s.Mean)
+	s.EA1c = eA1c(s.Mean)
+	return s, nil
+}
@@ -0,0 +1,117 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+var testStart = time.Date(2018, 6, 30, 0, 0, 0, 0, time.UTC)
+
+// series returns SGV entries at 5-minute intervals starting at t,
+// in reverse chronological order.
+func series(t time.Time, bgs ...int) nightscout.Entries {
+	entries := make(nightscout.Entries, len(bgs))
+	for i, bg := range bgs {
+		entries[len(bgs)-1-i] = sgvEntry(t, bg)
+		t = t.Add(5 * time.Minute)
+	}
+	return entries
+}
+
+func sgvEntry(t time.Time, bg int) nightscout.Entry {
+	return nightscout.Entry{Type: nightscout.SGVType, Date: nightscout.Date(t), SGV: bg}
+}
+
+func closeTo(x, y, tolerance float64) bool {
+	return math.Abs(x-y) <= tolerance
+}
+
+func TestBasicStats(t *testing.T) {
+	entries := series(testStart, 100, 200, 5, 150, 150)
+	// Entries that are not glucose values are ignored.
+	entries = append(entries, nightscout.Entry{Type: nightscout.MBGType, Date: nightscout.Date(testStart), MBG: 300})
+	cases := []struct {
+		name string
+		f    func(nightscout.Entries) float64
+		val  float64
+	}{
+		{"Mean", Mean, 150},
+		{"SD", SD, 40.8248},
+		{"CV", CV, 27.2166},
+		{"GMI", GMI, 6.898},
+		{"EA1c", EA1c, 6.8537},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			val := c.f(entries)
+			if !closeTo(val, c.val, 1e-4) {
+				t.Errorf("%s == %v, want %v", c.name, val, c.val)
+			}
+			if !math.IsNaN(c.f(nil)) {
+				t.Errorf("%s(nil) == %v, want NaN", c.name, c.f(nil))
+			}
+		})
+	}
+}
+
+func TestTimeInRange(t *testing.T) {
+	entries := series(testStart, 50, 60, 100, 180, 181, 250, 251, 300)
+	tir := TimeInRange(entries, ConsensusBands)
+	want := []float64{0.125, 0.125, 0.25, 0.25, 0.25}
+	for i := range want {
+		if tir[i] != want[i] {
+			t.Errorf("TimeInRange(%q) == %v, want %v", ConsensusBands[i].Name, tir[i], want[i])
+		}
+	}
+	tir = TimeInRange(entries, []Band{{"target", 100, 200}})
+	if tir[0] != 0.375 {
+		t.Errorf("TimeInRange(100-200) == %v, want 0.375", tir[0])
+	}
+}
+
+func TestRiskIndexes(t *testing.T) {
+	cases := []struct {
+		bgs  []int
+		lbgi float64
+		hbgi float64
+		gri  float64
+	}{
+		{[]int{50}, 22.5004, 0, 100},
+		{[]int{300}, 0, 33.952, 100},
+		{[]int{50, 300}, 11.2502, 16.976, 100},
+		{[]int{60, 100, 100, 100, 100, 100, 100, 100, 100, 200}, 1.7427, 1.1605, 32},
+	}
+	for _, c := range cases {
+		entries := series(testStart, c.bgs...)
+		lbgi := LBGI(entries)
+		hbgi := HBGI(entries)
+		gri := GRI(entries)
+		if !closeTo(lbgi, c.lbgi, 1e-3) || !closeTo(hbgi, c.hbgi, 1e-3) || !closeTo(gri, c.gri, 1e-9) {
+			t.Errorf("%v: LBGI, HBGI, GRI == %.4f, %.4f, %v, want %v, %v, %v", c.bgs, lbgi, hbgi, gri, c.lbgi, c.hbgi, c.gri)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	entries := series(testStart, 100, 200, 100, 200, 100)
+	s, err := Summarize(entries, ConsensusBands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Readings != 5 || !s.Start.Equal(testStart) || !s.End.Equal(testStart.Add(20*time.Minute)) {
+		t.Errorf("Summarize == %d readings from %v to %v", s.Readings, s.Start, s.End)
+	}
+	if s.Mean != 140 || s.MAGE != 100 || s.TimeInRange[2] != 0.6 || s.TimeInRange[3] != 0.4 {
+		t.Errorf("Summarize == %+v", s)
+	}
+	if !math.IsNaN(s.MODD) {
+		t.Errorf("MODD == %v, want NaN", s.MODD)
+	}
+	_, err = Summarize(series(testStart, 100), ConsensusBands)
+	if err == nil {
+		t.Errorf("Summarize with 1 reading succeeded")
+	}
+}
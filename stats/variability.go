@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+// Readings compared by MODD or CONGA must be less than lagTolerance
+// from the exact lag apart.
+const lagTolerance = 5 * time.Minute
+
+// MAGE returns the mean amplitude of glycemic excursions in mg/dL.
+// Excursions are rises or falls between turning points
+// that are larger than one standard deviation;
+// smaller fluctuations within an excursion are ignored.
+// Both rising and falling excursions are included.
+func MAGE(entries nightscout.Entries) float64 {
+	return mage(values(readings(entries)))
+}
+
+func mage(v []float64) float64 {
+	s := sd(v)
+	if math.IsNaN(s) || s == 0 {
+		return math.NaN()
+	}
+	// Until the first excursion, track the lowest and highest readings,
+	// since it starts from whichever is on the opposite side.
+	lo, hi := v[0], v[0]
+	i := 1
+	var ext []float64
+	for ; i < len(v) && ext == nil; i++ {
+		y := v[i]
+		switch {
+		case y-lo > s:
+			ext = []float64{lo, y}
+		case hi-y > s:
+			ext = []float64{hi, y}
+		default:
+			lo = math.Min(lo, y)
+			hi = math.Max(hi, y)
+		}
+	}
+	if ext == nil {
+		return math.NaN()
+	}
+	// ext holds the extremes of successive excursions.
+	for _, y := range v[i:] {
+		last, prev := ext[len(ext)-1], ext[len(ext)-2]
+		if (last > prev && y >= last) || (last < prev && y <= last) {
+			// Extend the current excursion.
+			ext[len(ext)-1] = y
+			continue
+		}
+		if math.Abs(y-last) > s {
+			ext = append(ext, y)
+		}
+	}
+	sum := 0.0
+	for i := 1; i < len(ext); i++ {
+		sum += math.Abs(ext[i] - ext[i-1])
+	}
+	return sum / float64(len(ext)-1)
+}
+
+// MODD returns the mean of daily differences in mg/dL:
+// the mean absolute difference between readings 24 hours apart.
+func MODD(entries nightscout.Entries) float64 {
+	return modd(readings(entries))
+}
+
+func modd(r []reading) float64 {
+	d := lagged(r, 24*time.Hour)
+	for i := range d {
+		d[i] = math.Abs(d[i])
+	}
+	return mean(d)
+}
+
+// CONGA returns the continuous overall net glycemic action in mg/dL:
+// the standard deviation of the differences between readings
+// and those the given time earlier, usually 1 to 4 hours.
+func CONGA(entries nightscout.Entries, lag time.Duration) float64 {
+	return conga(readings(entries), lag)
+}
+
+func conga(r []reading, lag time.Duration) float64 {
+	return sd(lagged(r, lag))
+}
+
+// lagged returns the differences between each reading and the one closest
+// to the given time earlier, for readings that have one less than lagTolerance away.
+// The readings must be in chronological order.
+func lagged(r []reading, lag time.Duration) []float64 {
+	var d []float64
+	for _, x := range r {
+		t := x.t.Add(-lag)
+		// Find the first reading at or after t and compare it with the one before.
+		j := sort.Search(len(r), func(k int) bool { return !r[k].t.Before(t) })
+		best := -1
+		bestDiff := lagTolerance
+		for _, k := range []int{j - 1, j} {
+			if k < 0 || k >= len(r) {
+				continue
+			}
+			diff := r[k].t.Sub(t)
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff < bestDiff {
+				best, bestDiff = k, diff
+			}
+		}
+		if best >= 0 {
+			d = append(d, x.bg-r[best].bg)
+		}
+	}
+	return d
+}
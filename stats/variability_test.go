@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ecc1/nightscout"
+)
+
+func TestMAGE(t *testing.T) {
+	cases := []struct {
+		bgs  []int
+		mage float64
+	}{
+		{[]int{100, 200, 100, 200, 100}, 100},
+		// Small fluctuations are ignored.
+		{[]int{100, 110, 105, 200, 190, 195, 100}, 100},
+		{[]int{100, 150, 200, 250, 200, 150, 160, 100}, 150},
+		// The first excursion starts from the opposite extreme.
+		{[]int{100, 120, 50}, 70},
+		{[]int{100, 80, 150}, 70},
+		{[]int{100, 100, 100}, math.NaN()},
+		{[]int{100}, math.NaN()},
+	}
+	for _, c := range cases {
+		mage := MAGE(series(testStart, c.bgs...))
+		if mage != c.mage && !(math.IsNaN(mage) && math.IsNaN(c.mage)) {
+			t.Errorf("MAGE(%v) == %v, want %v", c.bgs, mage, c.mage)
+		}
+	}
+}
+
+// days returns a day of readings every 5 minutes given by f,
+// repeated with the offset for each day added.
+func days(f func(i int) int, offsets ...int) nightscout.Entries {
+	var entries nightscout.Entries
+	for d, off := range offsets {
+		start := testStart.Add(time.Duration(d) * 24 * time.Hour)
+		bgs := make([]int, 288)
+		for i := range bgs {
+			bgs[i] = f(i) + off
+		}
+		entries = append(series(start, bgs...), entries...)
+	}
+	return entries
+}
+
+func TestMODD(t *testing.T) {
+	sawtooth := func(i int) int { return 100 + i%24 }
+	modd := MODD(days(sawtooth, 0, 10))
+	if modd != 10 {
+		t.Errorf("MODD == %v, want 10", modd)
+	}
+	modd = MODD(days(sawtooth, 0, 10, -10))
+	if modd != 15 {
+		t.Errorf("MODD == %v, want 15", modd)
+	}
+	// Readings a few minutes off from 24 hours apart are still compared.
+	entries := series(testStart, 100, 100, 100)
+	entries = append(series(testStart.Add(24*time.Hour+3*time.Minute), 120, 120, 120), entries...)
+	modd = MODD(entries)
+	if modd != 20 {
+		t.Errorf("MODD == %v, want 20", modd)
+	}
+	modd = MODD(series(testStart, 100, 100, 100))
+	if !math.IsNaN(modd) {
+		t.Errorf("MODD of 1 day == %v, want NaN", modd)
+	}
+}
+
+func TestCONGA(t *testing.T) {
+	// A steady rise of 1 mg/dL every 5 minutes gives the same
+	// difference each hour.
+	entries := days(func(i int) int { return 100 + i }, 0)
+	conga := CONGA(entries, time.Hour)
+	if conga != 0 {
+		t.Errorf("CONGA(1h) == %v, want 0", conga)
+	}
+	// Differences over 1 hour alternate between +12 and -12 every hour.
+	entries = days(func(i int) int { return 100 + 12*(i/12%2) }, 0)
+	conga = CONGA(entries, time.Hour)
+	if !closeTo(conga, 12, 0.05) {
+		t.Errorf("CONGA(1h) == %v, want 12", conga)
+	}
+	conga = CONGA(entries, 2*time.Hour)
+	if conga != 0 {
+		t.Errorf("CONGA(2h) == %v, want 0", conga)
+	}
+}
@@ -0,0 +1,201 @@
+package nightscout
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// EntryFormat represents the layout of a stream of entries.
+type EntryFormat int
+
+// Entry formats.
+const (
+	// JSONArray is a single JSON array of entries,
+	// as produced by Entries.Write and the Nightscout API.
+	JSONArray EntryFormat = iota
+	// NDJSON is a sequence of JSON entries separated by newlines.
+	NDJSON
+)
+
+func (f EntryFormat) String() string {
+	switch f {
+	case JSONArray:
+		return "JSON array"
+	case NDJSON:
+		return "NDJSON"
+	default:
+		return "unknown"
+	}
+}
+
+// EntryReader reads entries one at a time from a stream,
+// so that large files can be processed without reading them into memory.
+type EntryReader struct {
+	r      *bufio.Reader
+	dec    *json.Decoder
+	format EntryFormat
+	done   bool
+}
+
+// NewEntryReader returns an EntryReader for a JSON array or NDJSON stream of entries.
+// The format is determined from the first non-whitespace character.
+func NewEntryReader(r io.Reader) *EntryReader {
+	return &EntryReader{r: bufio.NewReader(r)}
+}
+
+// Format returns the format of the stream.
+// It is only valid after the first call to Next.
+func (r *EntryReader) Format() EntryFormat {
+	return r.format
+}
+
+// Next returns the next entry.
+// It returns io.EOF when there are no more entries.
+func (r *EntryReader) Next() (Entry, error) {
+	if r.done {
+		return Entry{}, io.EOF
+	}
+	if r.dec == nil {
+		err := r.start()
+		if err != nil {
+			return Entry{}, r.fail(err)
+		}
+	}
+	if r.format == JSONArray && !r.dec.More() {
+		return Entry{}, r.fail(r.end())
+	}
+	var e Entry
+	err := r.dec.Decode(&e)
+	if err != nil {
+		return Entry{}, r.fail(err)
+	}
+	return e, nil
+}
+
+// fail marks the reader as done and returns err.
+func (r *EntryReader) fail(err error) error {
+	r.done = true
+	return err
+}
+
+// start determines the format of the stream from its first non-whitespace character
+// and reads the opening bracket of an array.
+func (r *EntryReader) start() error {
+	r.dec = json.NewDecoder(r.r)
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			// io.EOF for empty input.
+			return err
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		_ = r.r.UnreadByte()
+		if c != '[' {
+			r.format = NDJSON
+			return nil
+		}
+		r.format = JSONArray
+		_, err = r.dec.Token()
+		return err
+	}
+}
+
+// end reads the closing bracket of an array
+// and checks that nothing else follows it.
+func (r *EntryReader) end() error {
+	_, err := r.dec.Token()
+	if err != nil {
+		return err
+	}
+	_, err = r.dec.Token()
+	if err != io.EOF {
+		return fmt.Errorf("unexpected data after array of entries")
+	}
+	return io.EOF
+}
+
+// ReadAll returns the remaining entries in the stream.
+func (r *EntryReader) ReadAll() (Entries, error) {
+	var entries Entries
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// EntryWriter writes entries one at a time to a stream.
+// The Close method must be called after the last entry is written.
+type EntryWriter struct {
+	w      *bufio.Writer
+	format EntryFormat
+	n      int
+}
+
+// NewEntryWriter returns an EntryWriter for a stream in the given format.
+// Arrays are indented in the same way as by Entries.Write.
+func NewEntryWriter(w io.Writer, format EntryFormat) *EntryWriter {
+	return &EntryWriter{w: bufio.NewWriter(w), format: format}
+}
+
+// Write writes an entry to the stream.
+func (w *EntryWriter) Write(e Entry) error {
+	var data []byte
+	var err error
+	if w.format == JSONArray {
+		data, err = json.MarshalIndent(e, "  ", "  ")
+	} else {
+		data, err = json.Marshal(e)
+	}
+	if err != nil {
+		return err
+	}
+	if w.format == JSONArray {
+		sep := ",\n  "
+		if w.n == 0 {
+			sep = "[\n  "
+		}
+		_, err = w.w.WriteString(sep)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.w.Write(data)
+	if err != nil {
+		return err
+	}
+	if w.format == NDJSON {
+		err = w.w.WriteByte('\n')
+		if err != nil {
+			return err
+		}
+	}
+	w.n++
+	return nil
+}
+
+// Close finishes the stream and flushes any buffered data.
+// It does not close the underlying io.Writer.
+func (w *EntryWriter) Close() error {
+	if w.format == JSONArray {
+		end := "\n]\n"
+		if w.n == 0 {
+			end = "[]\n"
+		}
+		_, err := w.w.WriteString(end)
+		if err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
@@ -0,0 +1,132 @@
+package nightscout
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEntryReader(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		format EntryFormat
+		sgvs   []int
+		ok     bool
+	}{
+		{"array", `[{"type":"sgv","sgv":100},{"type":"sgv","sgv":110}]`, JSONArray, []int{100, 110}, true},
+		{"indented array", "\n  [\n  {\"sgv\": 100},\n  {\"sgv\": 110}\n]\n\n", JSONArray, []int{100, 110}, true},
+		{"empty array", `[]`, JSONArray, nil, true},
+		{"ndjson", "{\"sgv\":100}\n{\"sgv\":110}\n{\"sgv\":120}\n", NDJSON, []int{100, 110, 120}, true},
+		{"ndjson without final newline", "{\"sgv\":100}\n{\"sgv\":110}", NDJSON, []int{100, 110}, true},
+		{"empty", "", JSONArray, nil, true},
+		{"whitespace", " \n ", JSONArray, nil, true},
+		{"truncated array", `[{"sgv":100},{"sgv":`, JSONArray, []int{100}, false},
+		{"unterminated array", `[{"sgv":100}`, JSONArray, []int{100}, false},
+		{"trailing data", `[{"sgv":100}] {"sgv":110}`, JSONArray, []int{100}, false},
+		{"invalid ndjson", "{\"sgv\":100}\n{sgv:110}\n", NDJSON, []int{100}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := NewEntryReader(strings.NewReader(c.input))
+			var sgvs []int
+			var err error
+			for {
+				var e Entry
+				e, err = r.Next()
+				if err != nil {
+					break
+				}
+				sgvs = append(sgvs, e.SGV)
+			}
+			if c.ok && err != io.EOF {
+				t.Errorf("Next returned %v, want io.EOF", err)
+			}
+			if !c.ok && (err == nil || err == io.EOF) {
+				t.Errorf("Next returned %v, want error", err)
+			}
+			if !equalInts(sgvs, c.sgvs) {
+				t.Errorf("read %v, want %v", sgvs, c.sgvs)
+			}
+			if r.Format() != c.format {
+				t.Errorf("Format() == %v, want %v", r.Format(), c.format)
+			}
+			// The reader stays at the end.
+			_, err = r.Next()
+			if err != io.EOF {
+				t.Errorf("Next after end returned %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func equalInts(x, y []int) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEntryWriter(t *testing.T) {
+	entries := sgvEntries(120, 115, 110)
+	entries[1].Direction = "FortyFiveUp"
+	for _, format := range []EntryFormat{JSONArray, NDJSON} {
+		t.Run(format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewEntryWriter(&buf, format)
+			for _, e := range entries {
+				err := w.Write(e)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := w.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format == JSONArray {
+				// The output is the same as writing all the entries at once.
+				var want bytes.Buffer
+				err = entries.Write(&want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if buf.String() != want.String() {
+					t.Errorf("EntryWriter wrote\n%s\nwant\n%s", buf.String(), want.String())
+				}
+			} else if n := strings.Count(buf.String(), "\n"); n != len(entries) {
+				t.Errorf("EntryWriter wrote %d lines, want %d", n, len(entries))
+			}
+			r := NewEntryReader(&buf)
+			v, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalEntries(v, entries) || r.Format() != format {
+				t.Errorf("read %v in %v format, want %v in %v format", v, r.Format(), entries, format)
+			}
+		})
+	}
+}
+
+func TestEmptyEntryWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewEntryWriter(&buf, JSONArray)
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadEntries(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries == nil || len(entries) != 0 {
+		t.Errorf("EntryWriter with no entries wrote %v, want empty array", entries)
+	}
+}
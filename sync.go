@@ -0,0 +1,393 @@
+package nightscout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SyncMode specifies the direction in which records are copied by Sync.
+type SyncMode int
+
+const (
+	// OneWay copies records from the source to the destination only.
+	OneWay SyncMode = iota
+	// TwoWay also copies records from the destination to the source.
+	TwoWay
+)
+
+const (
+	// DefaultSyncWindow is used when SyncOptions.Since is not specified.
+	DefaultSyncWindow = 24 * time.Hour
+
+	// DefaultSyncGap is used when SyncOptions.GapDuration is not specified.
+	DefaultSyncGap = 7 * time.Minute
+)
+
+// SyncOptions controls the behavior of Sync.
+type SyncOptions struct {
+	Mode SyncMode
+	// Since is the start of the time range to synchronize.
+	Since time.Time
+	// GapDuration is the minimum duration of a gap in entries to be filled.
+	GapDuration time.Duration
+}
+
+// SyncCounts records the number of records of each kind that were copied.
+type SyncCounts struct {
+	Entries      int
+	Treatments   int
+	DeviceStatus int
+	Profiles     int
+}
+
+// Conflict represents a record that is present on both websites
+// with different contents. Conflicting records are never overwritten.
+type Conflict struct {
+	Collection string
+	Key        string
+	Source     interface{}
+	Dest       interface{}
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s %s differs", c.Collection, c.Key)
+}
+
+// SyncReport summarizes the result of Sync.
+type SyncReport struct {
+	ToDest    SyncCounts // records copied from the source to the destination
+	ToSource  SyncCounts // records copied from the destination to the source (TwoWay mode only)
+	Conflicts []Conflict
+}
+
+// Sync copies entries, treatments, devicestatus records, and profiles
+// from src to dst (and from dst to src in TwoWay mode).
+// Entries are copied only to fill gaps in the receiving website.
+// Treatments, devicestatus records, and profiles are matched by their
+// identifying fields rather than their Nightscout IDs, which differ between
+// websites; records that match but differ are reported as conflicts.
+// Use SetNoUpload to find out what would be copied without changing anything.
+func Sync(src, dst *Website, opts SyncOptions) (SyncReport, error) {
+	return SyncContext(context.Background(), src, dst, opts)
+}
+
+// SyncContext is like Sync but uses the given context.
+func SyncContext(ctx context.Context, src, dst *Website, opts SyncOptions) (SyncReport, error) {
+	var r SyncReport
+	if opts.Since.IsZero() {
+		opts.Since = time.Now().Add(-DefaultSyncWindow)
+	}
+	if opts.GapDuration == 0 {
+		opts.GapDuration = DefaultSyncGap
+	}
+	n, err := syncEntries(ctx, src, dst, opts)
+	r.ToDest.Entries = n
+	if err != nil {
+		return r, err
+	}
+	if opts.Mode == TwoWay {
+		n, err = syncEntries(ctx, dst, src, opts)
+		r.ToSource.Entries = n
+		if err != nil {
+			return r, err
+		}
+	}
+	for _, s := range []func(context.Context, *Website, *Website, SyncOptions, *SyncReport) error{
+		syncTreatments,
+		syncDeviceStatus,
+		syncProfiles,
+	} {
+		err = s(ctx, src, dst, opts, &r)
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// syncEntries fills gaps in dst with entries from src.
+func syncEntries(ctx context.Context, src, dst *Website, opts SyncOptions) (int, error) {
+	gaps, err := dst.GapsContext(ctx, opts.Since, opts.GapDuration)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, g := range gaps {
+		entries, err := src.EntriesBetweenContext(ctx, g.Start, g.Finish)
+		if err != nil {
+			return n, err
+		}
+		missing := Missing(entries, []Gap{g})
+		if len(missing) == 0 {
+			continue
+		}
+		err = dst.UploadEntriesContext(ctx, missing)
+		if err != nil {
+			return n, err
+		}
+		n += len(missing)
+	}
+	return n, nil
+}
+
+func syncTreatments(ctx context.Context, src, dst *Website, opts SyncOptions, r *SyncReport) error {
+	now := time.Now()
+	a, err := src.TreatmentsBetweenContext(ctx, opts.Since, now)
+	if err != nil {
+		return err
+	}
+	b, err := dst.TreatmentsBetweenContext(ctx, opts.Since, now)
+	if err != nil {
+		return err
+	}
+	toDst, toSrc, conflicts := DiffTreatments(a, b)
+	r.Conflicts = append(r.Conflicts, conflicts...)
+	if len(toDst) != 0 {
+		err = dst.UploadTreatmentsContext(ctx, toDst)
+		if err != nil {
+			return err
+		}
+		r.ToDest.Treatments = len(toDst)
+	}
+	if opts.Mode == TwoWay && len(toSrc) != 0 {
+		err = src.UploadTreatmentsContext(ctx, toSrc)
+		if err != nil {
+			return err
+		}
+		r.ToSource.Treatments = len(toSrc)
+	}
+	return nil
+}
+
+func syncDeviceStatus(ctx context.Context, src, dst *Website, opts SyncOptions, r *SyncReport) error {
+	now := time.Now()
+	a, err := src.DeviceStatusBetweenContext(ctx, opts.Since, now)
+	if err != nil {
+		return err
+	}
+	b, err := dst.DeviceStatusBetweenContext(ctx, opts.Since, now)
+	if err != nil {
+		return err
+	}
+	toDst, toSrc, conflicts := DiffDeviceStatus(a, b)
+	r.Conflicts = append(r.Conflicts, conflicts...)
+	if len(toDst) != 0 {
+		err = dst.UploadContext(ctx, "api/v1/devicestatus", toDst)
+		if err != nil {
+			return err
+		}
+		r.ToDest.DeviceStatus = len(toDst)
+	}
+	if opts.Mode == TwoWay && len(toSrc) != 0 {
+		err = src.UploadContext(ctx, "api/v1/devicestatus", toSrc)
+		if err != nil {
+			return err
+		}
+		r.ToSource.DeviceStatus = len(toSrc)
+	}
+	return nil
+}
+
+// syncProfiles copies all missing profile records, regardless of Since,
+// since an old profile record may still be in effect.
+func syncProfiles(ctx context.Context, src, dst *Website, opts SyncOptions, r *SyncReport) error {
+	a, err := src.DownloadProfilesContext(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := dst.DownloadProfilesContext(ctx)
+	if err != nil {
+		return err
+	}
+	toDst, toSrc, conflicts := DiffProfiles(a, b)
+	r.Conflicts = append(r.Conflicts, conflicts...)
+	for _, p := range toDst {
+		err = dst.UploadProfileContext(ctx, p)
+		if err != nil {
+			return err
+		}
+		r.ToDest.Profiles++
+	}
+	if opts.Mode != TwoWay {
+		return nil
+	}
+	for _, p := range toSrc {
+		err = src.UploadProfileContext(ctx, p)
+		if err != nil {
+			return err
+		}
+		r.ToSource.Profiles++
+	}
+	return nil
+}
+
+// DiffTreatments compares two sets of treatments.
+// It returns the treatments that are only in a and only in b,
+// with their IDs cleared so they can be uploaded to the other website,
+// and the treatments that are in both but differ.
+// Treatments are matched by created_at time and event type.
+func DiffTreatments(a, b []Treatment) (onlyA, onlyB []Treatment, conflicts []Conflict) {
+	noID := func(r Treatment) Treatment {
+		r.ID = ""
+		return r
+	}
+	d := diff(len(a), len(b),
+		func(i int) string { return treatmentKey(a[i]) },
+		func(j int) string { return treatmentKey(b[j]) },
+		func(i, j int) bool { return sameJSON(noID(a[i]), noID(b[j])) })
+	for _, i := range d.onlyA {
+		onlyA = append(onlyA, noID(a[i]))
+	}
+	for _, j := range d.onlyB {
+		onlyB = append(onlyB, noID(b[j]))
+	}
+	for _, c := range d.conflicts {
+		conflicts = append(conflicts, Conflict{"treatments", c.key, noID(a[c.a]), noID(b[c.b])})
+	}
+	return onlyA, onlyB, conflicts
+}
+
+// DiffDeviceStatus compares two sets of devicestatus records, like DiffTreatments.
+// Records are matched by created_at time and device.
+func DiffDeviceStatus(a, b []DeviceStatus) (onlyA, onlyB []DeviceStatus, conflicts []Conflict) {
+	d := diff(len(a), len(b),
+		func(i int) string { return deviceStatusKey(a[i]) },
+		func(j int) string { return deviceStatusKey(b[j]) },
+		func(i, j int) bool { return sameJSON(withoutID(a[i]), withoutID(b[j])) })
+	for _, i := range d.onlyA {
+		onlyA = append(onlyA, withoutID(a[i]))
+	}
+	for _, j := range d.onlyB {
+		onlyB = append(onlyB, withoutID(b[j]))
+	}
+	for _, c := range d.conflicts {
+		conflicts = append(conflicts, Conflict{"devicestatus", c.key, withoutID(a[c.a]), withoutID(b[c.b])})
+	}
+	return onlyA, onlyB, conflicts
+}
+
+// DiffProfiles compares two sets of profile records, like DiffTreatments.
+// Records are matched by start date.
+func DiffProfiles(a, b []Profile) (onlyA, onlyB []Profile, conflicts []Conflict) {
+	noID := func(p Profile) Profile {
+		p.ID = ""
+		return p
+	}
+	d := diff(len(a), len(b),
+		func(i int) string { return profileKey(a[i]) },
+		func(j int) string { return profileKey(b[j]) },
+		func(i, j int) bool {
+			return a[i].DefaultProfile == b[j].DefaultProfile && sameJSON(a[i].Store, b[j].Store)
+		})
+	for _, i := range d.onlyA {
+		onlyA = append(onlyA, noID(a[i]))
+	}
+	for _, j := range d.onlyB {
+		onlyB = append(onlyB, noID(b[j]))
+	}
+	for _, c := range d.conflicts {
+		conflicts = append(conflicts, Conflict{"profile", c.key, noID(a[c.a]), noID(b[c.b])})
+	}
+	return onlyA, onlyB, conflicts
+}
+
+// recordDiff is the result of diff, as indexes into two sets of records.
+type recordDiff struct {
+	onlyA     []int
+	onlyB     []int
+	conflicts []recordPair
+}
+
+// recordPair identifies matching records that differ.
+type recordPair struct {
+	key  string
+	a, b int
+}
+
+// diff matches records in two sets, of sizes na and nb, by the keys
+// returned by keyA and keyB, and uses same to compare the matching records.
+// If several records in a set have the same key, the last one is used.
+// The results are in order of their keys.
+func diff(na, nb int, keyA, keyB func(int) string, same func(i, j int) bool) recordDiff {
+	ka, ia := keyIndex(na, keyA)
+	kb, ib := keyIndex(nb, keyB)
+	var d recordDiff
+	for _, k := range ka {
+		i := ia[k]
+		j, ok := ib[k]
+		if !ok {
+			d.onlyA = append(d.onlyA, i)
+		} else if !same(i, j) {
+			d.conflicts = append(d.conflicts, recordPair{key: k, a: i, b: j})
+		}
+	}
+	for _, k := range kb {
+		if _, ok := ia[k]; !ok {
+			d.onlyB = append(d.onlyB, ib[k])
+		}
+	}
+	return d
+}
+
+// keyIndex returns the distinct keys of n records in sorted order,
+// which is chronological for sync keys, and the index of the last record with each key.
+func keyIndex(n int, key func(int) string) ([]string, map[string]int) {
+	index := make(map[string]int, n)
+	var keys []string
+	for i := 0; i < n; i++ {
+		k := key(i)
+		if _, ok := index[k]; !ok {
+			keys = append(keys, k)
+		}
+		index[k] = i
+	}
+	sort.Strings(keys)
+	return keys, index
+}
+
+// syncKeyLayout is a fixed-width layout, so keys sort chronologically.
+const syncKeyLayout = "2006-01-02T15:04:05.000Z"
+
+func treatmentKey(r Treatment) string {
+	return r.CreatedAt.UTC().Format(syncKeyLayout) + "|" + r.EventType
+}
+
+func deviceStatusKey(r DeviceStatus) string {
+	return r.CreatedAt.UTC().Format(syncKeyLayout) + "|" + r.Device
+}
+
+func profileKey(p Profile) string {
+	return p.StartDate.UTC().Format(syncKeyLayout)
+}
+
+// withoutID removes the Nightscout ID from a devicestatus record.
+func withoutID(r DeviceStatus) DeviceStatus {
+	if _, ok := r.Extra["_id"]; !ok {
+		return r
+	}
+	extra := make(Extra, len(r.Extra))
+	for k, v := range r.Extra {
+		if k != "_id" {
+			extra[k] = v
+		}
+	}
+	r.Extra = extra
+	return r
+}
+
+// sameJSON reports whether two values have the same JSON encoding.
+func sameJSON(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(x, y)
+}
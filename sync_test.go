@@ -0,0 +1,71 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffTreatments(t *testing.T) {
+	note := NewNote(T[0], "on both")
+	changed := NewNote(T[1], "before")
+	a := []Treatment{note, changed, NewNote(T[2], "only in a")}
+	note.ID = "b0"
+	edited := changed
+	edited.Notes = "after"
+	b := []Treatment{note, edited, NewSiteChange(T[2]), NewNote(T[3], "only in b")}
+	onlyA, onlyB, conflicts := DiffTreatments(a, b)
+	if !reflect.DeepEqual(onlyA, a[2:]) {
+		t.Errorf("onlyA == %+v, want %+v", onlyA, a[2:])
+	}
+	// Results are in chronological order.
+	want := []Treatment{b[3], b[2]}
+	if !reflect.DeepEqual(onlyB, want) {
+		t.Errorf("onlyB == %+v, want %+v", onlyB, want)
+	}
+	if len(conflicts) != 1 || conflicts[0].Source.(Treatment).Notes != "before" || conflicts[0].Dest.(Treatment).Notes != "after" {
+		t.Errorf("conflicts == %+v, want %v", conflicts, changed.CreatedAt)
+	}
+}
+
+func TestDiffDeviceStatus(t *testing.T) {
+	withID := func(s DeviceStatus, id string) DeviceStatus {
+		s.Extra = Extra{"_id": json.RawMessage(`"` + id + `"`)}
+		return s
+	}
+	s0 := DeviceStatus{CreatedAt: T[0], Device: "openaps://rig"}
+	s1 := DeviceStatus{CreatedAt: T[0], Device: "loop://iPhone"}
+	s2 := DeviceStatus{CreatedAt: T[1], Device: "openaps://rig"}
+	a := []DeviceStatus{withID(s0, "a0"), withID(s1, "a1")}
+	b := []DeviceStatus{withID(s0, "b0"), withID(s2, "b2")}
+	onlyA, onlyB, conflicts := DiffDeviceStatus(a, b)
+	// Nightscout IDs are removed.
+	if len(onlyA) != 1 || onlyA[0].Device != s1.Device || len(onlyA[0].Extra) != 0 {
+		t.Errorf("onlyA == %+v, want %+v", onlyA, s1)
+	}
+	if len(onlyB) != 1 || onlyB[0].CreatedAt != s2.CreatedAt || len(onlyB[0].Extra) != 0 {
+		t.Errorf("onlyB == %+v, want %+v", onlyB, s2)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("conflicts == %+v, want none", conflicts)
+	}
+}
+
+func TestDiffProfiles(t *testing.T) {
+	var p Profile
+	err := json.Unmarshal([]byte(testProfile), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := p
+	q.ID = "another"
+	onlyA, onlyB, conflicts := DiffProfiles([]Profile{p}, []Profile{q})
+	if len(onlyA) != 0 || len(onlyB) != 0 || len(conflicts) != 0 {
+		t.Errorf("DiffProfiles(p, p) == %v, %v, %v, want nothing", onlyA, onlyB, conflicts)
+	}
+	q.DefaultProfile = "Other"
+	_, _, conflicts = DiffProfiles([]Profile{p}, []Profile{q})
+	if len(conflicts) != 1 {
+		t.Errorf("conflicts == %+v, want 1", conflicts)
+	}
+}
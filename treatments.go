@@ -0,0 +1,93 @@
+package nightscout
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// UploadTreatments uploads treatments to Nightscout.
+func (w Website) UploadTreatments(treatments []Treatment) error {
+	return w.UploadTreatmentsContext(context.Background(), treatments)
+}
+
+// UploadTreatmentsContext uploads treatments to Nightscout
+// using the given context.
+func (w Website) UploadTreatmentsContext(ctx context.Context, treatments []Treatment) error {
+	return w.UploadContext(ctx, "api/v1/treatments", treatments)
+}
+
+// DownloadTreatments downloads the treatments matching the given query from Nightscout,
+// most recent first.
+// If no count is specified, Nightscout returns at most 10 treatments.
+func (w Website) DownloadTreatments(q *Query) ([]Treatment, error) {
+	return w.DownloadTreatmentsContext(context.Background(), q)
+}
+
+// DownloadTreatmentsContext downloads the treatments matching the given query from Nightscout,
+// most recent first, using the given context.
+func (w Website) DownloadTreatmentsContext(ctx context.Context, q *Query) ([]Treatment, error) {
+	var treatments []Treatment
+	err := w.GetContext(ctx, queryAPI("api/v1/treatments", q), &treatments)
+	return treatments, err
+}
+
+// DeleteTreatment deletes the treatment with the given ID from Nightscout.
+func (w Website) DeleteTreatment(id string) error {
+	return w.DeleteTreatmentContext(context.Background(), id)
+}
+
+// DeleteTreatmentContext deletes the treatment with the given ID from Nightscout
+// using the given context.
+func (w Website) DeleteTreatmentContext(ctx context.Context, id string) error {
+	return w.DeleteContext(ctx, "api/v1/treatments/"+url.PathEscape(id))
+}
+
+// LatestTreatmentTime returns the time of the most recent Nightscout treatment,
+// or the zero time if there are none.
+func (w Website) LatestTreatmentTime() (time.Time, error) {
+	return w.LatestTreatmentTimeContext(context.Background())
+}
+
+// LatestTreatmentTimeContext returns the time of the most recent Nightscout treatment,
+// or the zero time if there are none, using the given context.
+func (w Website) LatestTreatmentTimeContext(ctx context.Context) (time.Time, error) {
+	var times []TreatmentTime
+	err := w.GetContext(ctx, queryAPI("api/v1/treatments", NewQuery().Count(1)), &times)
+	if err != nil || len(times) == 0 {
+		return time.Time{}, err
+	}
+	return times[0].CreatedAt, nil
+}
+
+// TreatmentsBetween downloads the treatments from start to end, inclusive,
+// most recent first.
+// Treatments are downloaded in pages of PageSize records.
+func (w Website) TreatmentsBetween(start, end time.Time) ([]Treatment, error) {
+	return w.TreatmentsBetweenContext(context.Background(), start, end)
+}
+
+// TreatmentsBetweenContext downloads the treatments from start to end, inclusive,
+// most recent first, using the given context.
+func (w Website) TreatmentsBetweenContext(ctx context.Context, start, end time.Time) ([]Treatment, error) {
+	var result []Treatment
+	seen := make(map[string]bool)
+	err := w.walkCreated(start, end, func(q *Query) ([]time.Time, error) {
+		page, err := w.DownloadTreatmentsContext(ctx, q)
+		times := make([]time.Time, len(page))
+		for i, r := range page {
+			times[i] = r.CreatedAt
+			k := r.ID
+			if len(k) == 0 {
+				k = treatmentKey(r)
+			}
+			if seen[k] || r.CreatedAt.Before(start) || r.CreatedAt.After(end) {
+				continue
+			}
+			seen[k] = true
+			result = append(result, r)
+		}
+		return times, err
+	})
+	return result, err
+}
@@ -0,0 +1,68 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTreatments(t *testing.T) {
+	created := parseTime("2018-06-30 12:00")
+	var stored []Treatment
+	var deleted string
+	w, cleanup := testSite(t, func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v1/treatments":
+			var v []Treatment
+			_ = json.NewDecoder(r.Body).Decode(&v)
+			stored = append(v, stored...)
+		case r.Method == "GET" && r.URL.Path == "/api/v1/treatments":
+			_ = json.NewEncoder(rw).Encode(stored)
+		case r.Method == "DELETE" && r.URL.Path == "/api/v1/treatments/5b37a7d0":
+			deleted = "5b37a7d0"
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+	tt, err := w.LatestTreatmentTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tt.IsZero() {
+		t.Errorf("LatestTreatmentTime == %v, want zero time", tt)
+	}
+	err = w.UploadTreatments([]Treatment{
+		{CreatedAt: created, EventType: "Note"},
+		{CreatedAt: created.Add(-time.Hour), EventType: "Note"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	treatments, err := w.DownloadTreatments(NewQuery().Eq("eventType", "Note"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(treatments) != 2 {
+		t.Errorf("DownloadTreatments returned %d treatments, want 2", len(treatments))
+	}
+	tt, err = w.LatestTreatmentTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tt.Equal(created) {
+		t.Errorf("LatestTreatmentTime == %v, want %v", tt, created)
+	}
+	err = w.DeleteTreatment("5b37a7d0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != "5b37a7d0" {
+		t.Errorf("DeleteTreatment did not delete treatment")
+	}
+	err = w.DeleteTreatment("nonexistent")
+	if !IsNotFound(err) {
+		t.Errorf("DeleteTreatment(nonexistent) returned %v", err)
+	}
+}
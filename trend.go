@@ -1,61 +1,183 @@
 package nightscout
 
 import (
+	"math"
 	"time"
 )
 
-const (
-	trendEntries = 4
-	trendWindow  = trendEntries * 5 * time.Minute
+// TrendClassifier determines the glucose trend arrow from recent entries,
+// using the slope of a line fitted to them.
+type TrendClassifier struct {
+	// Thresholds are the rates of change, in mg/dL per minute,
+	// above which the FortyFive, Single, and Double arrows are used.
+	// The same thresholds are used for falling glucose.
+	// Use math.Inf(1) to disable an arrow.
+	Thresholds [3]float64
+	// MaxEntries is the maximum number of entries used, including the current one,
+	// or 0 for no limit.
+	MaxEntries int
+	// MinPoints is the minimum number of entries needed to determine a trend.
+	MinPoints int
+	// Window is the maximum age of entries relative to the current one,
+	// or 0 for no limit.
+	Window time.Duration
+	// MaxGap is the maximum time between consecutive entries,
+	// or 0 for no limit.
+	MaxGap time.Duration
+	// Interval is the sampling interval.
+	// Entries less than half an interval after the previous entry used are skipped,
+	// so that more frequent readings do not shorten the history.
+	// If it is 0, all entries are used.
+	Interval time.Duration
+	// Regression fits a line to the entries. If it is nil, FindLine is used.
+	// A robust method such as FindHuberLine reduces the effect of
+	// outliers such as compression lows.
+	Regression Regression
+}
+
+var (
+	// DefaultTrend is the classifier used by Trend.
+	DefaultTrend = TrendClassifier{
+		Thresholds: [3]float64{1, 2, 3},
+		MaxEntries: 4,
+		MinPoints:  2,
+		MaxGap:     20 * time.Minute,
+	}
+
+	// DexcomTrend approximates the arrows of Dexcom G6 and G7 sensors,
+	// which use the rate of change over the last 15 minutes.
+	DexcomTrend = TrendClassifier{
+		Thresholds: [3]float64{1, 2, 3},
+		MaxEntries: 4,
+		MinPoints:  3,
+		Window:     15 * time.Minute,
+		Interval:   5 * time.Minute,
+	}
+
+	// LibreTrend approximates the arrows of FreeStyle Libre sensors,
+	// which use the rate of change over the last 15 minutes
+	// and have no double arrows.
+	LibreTrend = TrendClassifier{
+		Thresholds: [3]float64{1, 2, math.Inf(1)},
+		MaxEntries: 16,
+		MinPoints:  3,
+		Window:     15 * time.Minute,
+		Interval:   time.Minute,
+	}
+
+	// XDripTrend matches xDrip, which uses the slope
+	// between the two most recent readings.
+	XDripTrend = TrendClassifier{
+		Thresholds: [3]float64{1, 2, 3.5},
+		MaxEntries: 2,
+		MinPoints:  2,
+		MaxGap:     20 * time.Minute,
+	}
+
+	// TrendPresets maps names to the predefined classifiers.
+	TrendPresets = map[string]TrendClassifier{
+		"default": DefaultTrend,
+		"dexcom":  DexcomTrend,
+		"libre":   LibreTrend,
+		"xdrip":   XDripTrend,
+	}
 )
 
 // Trend returns a string describing the glucose trend,
 // assuming the entries are in reverse chronological order.
+// It uses DefaultTrend.
 func Trend(entries Entries) string {
+	return DefaultTrend.Trend(entries)
+}
+
+// Trend returns a string describing the glucose trend,
+// assuming the entries are in reverse chronological order,
+// or "" if there are not enough recent entries.
+func (c TrendClassifier) Trend(entries Entries) string {
+	if len(entries) == 0 {
+		return ""
+	}
 	cur := entries[0]
 	if cur.Type != SGVType {
 		return ""
 	}
-	history := getHistory(entries)
-	if len(history) == 1 {
+	history := c.history(entries)
+	if len(history) < 2 || len(history) < c.MinPoints {
 		return ""
 	}
-	slope := FindLine(history).Slope
-	if slope > 3 {
+	line, err := c.fit(history)
+	if err != nil {
+		return ""
+	}
+	return c.Classify(line.Slope)
+}
+
+// fit fits a line to the points using the classifier's regression function.
+func (c TrendClassifier) fit(points Points) (Line, error) {
+	if c.Regression != nil {
+		return c.Regression(points)
+	}
+	return FindLine(points)
+}
+
+// Lookback returns how far before an entry the classifier may use other entries,
+// or 0 if there is no limit.
+func (c TrendClassifier) Lookback() time.Duration {
+	if c.Window != 0 {
+		return c.Window
+	}
+	if c.MaxGap != 0 && c.MaxEntries != 0 {
+		return time.Duration(c.MaxEntries-1) * c.MaxGap
+	}
+	return 0
+}
+
+// Classify returns the trend arrow for a rate of change in mg/dL per minute.
+func (c TrendClassifier) Classify(slope float64) string {
+	t := c.Thresholds
+	if slope > t[2] {
 		return "DoubleUp"
 	}
-	if slope > 2 {
+	if slope > t[1] {
 		return "SingleUp"
 	}
-	if slope > 1 {
+	if slope > t[0] {
 		return "FortyFiveUp"
 	}
-	if slope >= -1 {
+	if slope >= -t[0] {
 		return "Flat"
 	}
-	if slope >= -2 {
+	if slope >= -t[1] {
 		return "FortyFiveDown"
 	}
-	if slope >= -3 {
+	if slope >= -t[2] {
 		return "SingleDown"
 	}
 	return "DoubleDown"
 }
 
-func getHistory(entries Entries) Entries {
-	history := make(Entries, 0, trendEntries)
+func (c TrendClassifier) history(entries Entries) Entries {
+	history := make(Entries, 0, c.MaxEntries)
 	history = append(history, entries[0])
+	first := entries[0].Time()
 	for _, e := range entries[1:] {
-		if len(history) == trendEntries {
+		if len(history) == c.MaxEntries {
 			break
 		}
 		if e.Type != SGVType {
 			continue
 		}
-		d := history[len(history)-1]
-		if d.Time().Sub(e.Time()) > trendWindow {
+		t := e.Time()
+		if c.Window != 0 && first.Sub(t) > c.Window {
 			break
 		}
+		d := history[len(history)-1].Time().Sub(t)
+		if c.MaxGap != 0 && d > c.MaxGap {
+			break
+		}
+		if d < c.Interval/2 {
+			continue
+		}
 		history = append(history, e)
 	}
 	return history
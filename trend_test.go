@@ -21,7 +21,11 @@ func TestTrend(t *testing.T) {
 	}
 	for _, c := range cases {
 		t.Run(c.trend, func(t *testing.T) {
-			slope := FindLine(c.entries).Slope
+			line, err := FindLine(c.entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slope := line.Slope
 			if !closeEnough(slope, c.slope) {
 				t.Errorf("Slope == %v, want %v", slope, c.slope)
 			}
@@ -33,6 +37,78 @@ func TestTrend(t *testing.T) {
 	}
 }
 
+func TestTrendPresets(t *testing.T) {
+	rising := sgvEntries(126, 108, 93, 79)
+	gap := append(sgvEntries(120, 110), sgvEntry(parseTime("2018-06-30 11:35"), 90))
+	cases := []struct {
+		entries Entries
+		preset  string
+		trend   string
+	}{
+		{rising, "default", "DoubleUp"},
+		{rising, "dexcom", "DoubleUp"},
+		// Libre sensors have no double arrows.
+		{rising, "libre", "SingleUp"},
+		// xDrip uses only the last two readings: (126 - 108) / 5 = 3.6.
+		{rising, "xdrip", "DoubleUp"},
+		{rising[1:], "xdrip", "SingleUp"},
+		{sgvEntries(100, 94), "dexcom", ""},
+		{sgvEntries(100, 94), "xdrip", "FortyFiveUp"},
+		// The third entry is outside the Dexcom window.
+		{gap, "default", "FortyFiveUp"},
+		{gap, "dexcom", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.preset+"/"+c.trend, func(t *testing.T) {
+			trend := TrendPresets[c.preset].Trend(c.entries)
+			if trend != c.trend {
+				t.Errorf("%s Trend == %q, want %q", c.preset, trend, c.trend)
+			}
+		})
+	}
+}
+
+func TestLookback(t *testing.T) {
+	cases := []struct {
+		c        TrendClassifier
+		lookback time.Duration
+	}{
+		{DefaultTrend, time.Hour},
+		{DexcomTrend, 15 * time.Minute},
+		{XDripTrend, 20 * time.Minute},
+		{TrendClassifier{MaxEntries: 4}, 0},
+		{TrendClassifier{MaxGap: 10 * time.Minute}, 0},
+	}
+	for _, c := range cases {
+		d := c.c.Lookback()
+		if d != c.lookback {
+			t.Errorf("Lookback(%+v) == %v, want %v", c.c, d, c.lookback)
+		}
+	}
+}
+
+func TestTrendInterval(t *testing.T) {
+	// Readings every minute, rising by 1 mg/dL/min
+	// except for a spike in the latest reading.
+	base := parseTime("2018-06-30 12:00")
+	var entries Entries
+	for i := 0; i <= 15; i++ {
+		bg := 150 - i
+		if i == 0 {
+			bg = 158
+		}
+		entries = append(entries, sgvEntry(base.Add(-time.Duration(i)*time.Minute), bg))
+	}
+	c := TrendClassifier{Thresholds: [3]float64{1, 2, 3}, MaxEntries: 4, MinPoints: 4}
+	if trend := c.Trend(entries); trend != "DoubleUp" {
+		t.Errorf("Trend without interval == %q, want DoubleUp", trend)
+	}
+	c.Interval = 5 * time.Minute
+	if trend := c.Trend(entries); trend != "FortyFiveUp" {
+		t.Errorf("Trend with 5-minute interval == %q, want FortyFiveUp", trend)
+	}
+}
+
 func sgvEntry(t time.Time, bg int) Entry {
 	return Entry{
 		Date:       Date(t),
@@ -0,0 +1,239 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GlucoseUnit represents the units of glucose values
+// in Nightscout treatments and profiles.
+type GlucoseUnit string
+
+// Glucose units, as stored by Nightscout.
+const (
+	MgdlUnits GlucoseUnit = "mg/dl"
+	MmolUnits GlucoseUnit = "mmol"
+)
+
+// mgdlPerMmol is the conversion factor used by Nightscout.
+const mgdlPerMmol = 18.0
+
+// maxMmol is the largest glucose value that is interpreted as mmol/L
+// when a value in mmol/L is expected but might be in mg/dL.
+const maxMmol = 40
+
+// ParseGlucoseUnit converts a string to a GlucoseUnit.
+// It accepts the variants of "mg/dl" and "mmol" used by Nightscout and uploaders,
+// regardless of case.
+func ParseGlucoseUnit(s string) (GlucoseUnit, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "mg/dl", "mgdl", "mg":
+		return MgdlUnits, nil
+	case "mmol", "mmol/l", "mmoll":
+		return MmolUnits, nil
+	default:
+		return "", fmt.Errorf("unknown glucose units %q", s)
+	}
+}
+
+// String returns the conventional name of the units for display.
+func (u GlucoseUnit) String() string {
+	switch u {
+	case MgdlUnits:
+		return "mg/dL"
+	case MmolUnits:
+		return "mmol/L"
+	default:
+		return string(u)
+	}
+}
+
+// normalize returns the canonical form of u, or MgdlUnits if it is empty or unknown,
+// which is how Nightscout treats such values.
+func (u GlucoseUnit) normalize() GlucoseUnit {
+	v, err := ParseGlucoseUnit(string(u))
+	if err != nil {
+		return MgdlUnits
+	}
+	return v
+}
+
+// FromMgdl converts a glucose value in mg/dL to these units.
+func (u GlucoseUnit) FromMgdl(bg float64) float64 {
+	if u.normalize() == MmolUnits {
+		return bg / mgdlPerMmol
+	}
+	return bg
+}
+
+// ToMgdl converts a glucose value in these units to mg/dL.
+func (u GlucoseUnit) ToMgdl(v float64) float64 {
+	if u.normalize() == MmolUnits {
+		return v * mgdlPerMmol
+	}
+	return v
+}
+
+// Convert converts a glucose value in these units to the given units.
+func (u GlucoseUnit) Convert(v float64, to GlucoseUnit) float64 {
+	return to.FromMgdl(u.ToMgdl(v))
+}
+
+// Format formats a glucose value in mg/dL for display in these units:
+// as an integer for mg/dL and with one decimal place for mmol/L.
+func (u GlucoseUnit) Format(bg float64) string {
+	if u.normalize() == MmolUnits {
+		return strconv.FormatFloat(u.FromMgdl(bg), 'f', 1, 64)
+	}
+	return strconv.Itoa(int(math.Round(bg)))
+}
+
+// ParseGlucose parses a glucose value in these units and returns it in mg/dL.
+func (u GlucoseUnit) ParseGlucose(s string) (Glucose, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid glucose value %q", s)
+	}
+	if v <= 0 {
+		return 0, fmt.Errorf("glucose value %q is not positive", s)
+	}
+	return Glucose(math.Round(u.ToMgdl(v))), nil
+}
+
+// Unit returns the glucose units of the profile data.
+// Nightscout uses mg/dL if the units are not specified.
+func (p ProfileData) Unit() (GlucoseUnit, error) {
+	if len(p.Units) == 0 {
+		return MgdlUnits, nil
+	}
+	return ParseGlucoseUnit(string(p.Units))
+}
+
+// Normalize returns a copy of the profile data with the insulin sensitivity
+// and targets converted to the given units.
+func (p ProfileData) Normalize(u GlucoseUnit) (ProfileData, error) {
+	from, err := p.Unit()
+	if err != nil {
+		return p, err
+	}
+	to, err := ParseGlucoseUnit(string(u))
+	if err != nil {
+		return p, err
+	}
+	for _, s := range []*Schedule{&p.Sens, &p.TargetLow, &p.TargetHigh} {
+		*s, err = s.convert(from, to)
+		if err != nil {
+			return p, err
+		}
+	}
+	p.Units = to
+	return p, nil
+}
+
+// Normalize returns a copy of the profile record
+// with all its profile data converted to the given units.
+func (p Profile) Normalize(u GlucoseUnit) (Profile, error) {
+	store := make(map[string]ProfileData, len(p.Store))
+	for name, data := range p.Store {
+		v, err := data.Normalize(u)
+		if err != nil {
+			return p, fmt.Errorf("profile %q: %v", name, err)
+		}
+		store[name] = v
+	}
+	p.Store = store
+	return p, nil
+}
+
+// convert returns a copy of the schedule with its values converted between units.
+func (s Schedule) convert(from, to GlucoseUnit) (Schedule, error) {
+	if s == nil {
+		return nil, nil
+	}
+	v := make(Schedule, len(s))
+	for i, tv := range s {
+		x, err := tv.Float()
+		if err != nil {
+			return nil, err
+		}
+		tv.Value = from.Convert(x, to)
+		v[i] = tv
+	}
+	return v, nil
+}
+
+// Unit returns the glucose units of the treatment.
+// Nightscout uses mg/dL if the units are not specified.
+func (r Treatment) Unit() GlucoseUnit {
+	return r.Units.normalize()
+}
+
+// treatmentJSON has the same fields as Treatment but not its methods,
+// so it can be used to marshal and unmarshal Treatment values.
+type treatmentJSON Treatment
+
+// Target returns the targets of a Temporary Target treatment in the given units.
+// Targets are left as stored, and Nightscout usually stores them in mg/dL
+// regardless of the treatment's units, so targets of 40 or more
+// are assumed to be in mg/dL even if the units are mmol/L.
+// The result is false if the treatment does not have both targets.
+func (r Treatment) Target(u GlucoseUnit) (bottom float64, top float64, ok bool) {
+	if r.TargetBottom == nil || r.TargetTop == nil {
+		return 0, 0, false
+	}
+	return r.targetIn(*r.TargetBottom, u), r.targetIn(*r.TargetTop, u), true
+}
+
+func (r Treatment) targetIn(v float64, u GlucoseUnit) float64 {
+	if r.Unit() == MmolUnits && v < maxMmol {
+		return MmolUnits.Convert(v, u)
+	}
+	return MgdlUnits.Convert(v, u)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// Nightscout stores the glucose value of a treatment in the treatment's units,
+// as a number or numeric string; it is converted to mg/dL.
+// An empty string means there is no glucose value.
+func (r *Treatment) UnmarshalJSON(data []byte) error {
+	v := struct {
+		*treatmentJSON
+		Glucose interface{} `json:"glucose,omitempty"`
+	}{treatmentJSON: (*treatmentJSON)(r)}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	u := r.Unit()
+	r.Glucose = nil
+	if v.Glucose != nil && v.Glucose != "" {
+		x, err := toFloat(v.Glucose)
+		if err != nil {
+			return fmt.Errorf("invalid treatment glucose: %v", err)
+		}
+		g := Glucose(math.Round(u.ToMgdl(x)))
+		r.Glucose = &g
+	}
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// The glucose value is converted from mg/dL to the treatment's units.
+func (r Treatment) MarshalJSON() ([]byte, error) {
+	v := struct {
+		treatmentJSON
+		Glucose interface{} `json:"glucose,omitempty"`
+	}{treatmentJSON: treatmentJSON(r)}
+	if r.Glucose != nil {
+		g := float64(*r.Glucose)
+		if r.Unit() == MmolUnits {
+			v.Glucose = math.Round(10*r.Unit().FromMgdl(g)) / 10
+		} else {
+			v.Glucose = *r.Glucose
+		}
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,260 @@
+package nightscout
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseGlucoseUnit(t *testing.T) {
+	cases := []struct {
+		s    string
+		unit GlucoseUnit
+	}{
+		{"mg/dl", MgdlUnits},
+		{"mg/dL", MgdlUnits},
+		{"mgdl", MgdlUnits},
+		{"mmol", MmolUnits},
+		{"mmol/L", MmolUnits},
+		{" MMOL ", MmolUnits},
+		{"", ""},
+		{"mg", MgdlUnits},
+		{"mol", ""},
+	}
+	for _, c := range cases {
+		u, err := ParseGlucoseUnit(c.s)
+		if c.unit == "" {
+			if err == nil {
+				t.Errorf("ParseGlucoseUnit(%q) == %q, want error", c.s, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseGlucoseUnit(%q) returned %v", c.s, err)
+			continue
+		}
+		if u != c.unit {
+			t.Errorf("ParseGlucoseUnit(%q) == %q, want %q", c.s, u, c.unit)
+		}
+	}
+}
+
+func TestGlucoseConversion(t *testing.T) {
+	cases := []struct {
+		unit   GlucoseUnit
+		mgdl   float64
+		value  float64
+		format string
+	}{
+		{MgdlUnits, 100, 100, "100"},
+		{MmolUnits, 99, 5.5, "5.5"},
+		{MmolUnits, 100, 100.0 / 18, "5.6"},
+		{"mmol/L", 180, 10, "10.0"},
+		{"", 120.4, 120.4, "120"},
+	}
+	for _, c := range cases {
+		v := c.unit.FromMgdl(c.mgdl)
+		if !closeEnough(v, c.value) {
+			t.Errorf("%q.FromMgdl(%v) == %v, want %v", c.unit, c.mgdl, v, c.value)
+		}
+		bg := c.unit.ToMgdl(c.value)
+		if !closeEnough(bg, c.mgdl) {
+			t.Errorf("%q.ToMgdl(%v) == %v, want %v", c.unit, c.value, bg, c.mgdl)
+		}
+		s := c.unit.Format(c.mgdl)
+		if s != c.format {
+			t.Errorf("%q.Format(%v) == %q, want %q", c.unit, c.mgdl, s, c.format)
+		}
+	}
+	if v := MmolUnits.Convert(5, MgdlUnits); v != 90 {
+		t.Errorf("Convert(5 mmol/L) == %v mg/dL, want 90", v)
+	}
+	if MgdlUnits.String() != "mg/dL" || MmolUnits.String() != "mmol/L" {
+		t.Errorf("String() == %q, %q", MgdlUnits.String(), MmolUnits.String())
+	}
+}
+
+func TestParseGlucose(t *testing.T) {
+	cases := []struct {
+		unit GlucoseUnit
+		s    string
+		bg   Glucose
+		ok   bool
+	}{
+		{MgdlUnits, "105", 105, true},
+		{MmolUnits, "5.5", 99, true},
+		{MmolUnits, " 6 ", 108, true},
+		{MmolUnits, "0", 0, false},
+		{MgdlUnits, "high", 0, false},
+	}
+	for _, c := range cases {
+		bg, err := c.unit.ParseGlucose(c.s)
+		if !c.ok {
+			if err == nil {
+				t.Errorf("ParseGlucose(%q) == %v, want error", c.s, bg)
+			}
+			continue
+		}
+		if err != nil || bg != c.bg {
+			t.Errorf("ParseGlucose(%q) == %v, %v, want %v", c.s, bg, err, c.bg)
+		}
+	}
+}
+
+func TestNormalizeProfile(t *testing.T) {
+	var p Profile
+	err := json.Unmarshal([]byte(testProfile), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mmol, err := p.Normalize(MmolUnits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := mmol.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Units != MmolUnits {
+		t.Errorf("normalized profile has units %q", data.Units)
+	}
+	orig, _ := p.Default()
+	for i, tv := range data.Sens {
+		x, _ := tv.Float()
+		y, _ := orig.Sens[i].Float()
+		if !closeEnough(x, y/18) || tv.Time != orig.Sens[i].Time {
+			t.Errorf("normalized sens[%d] == %+v, want %v at %s", i, tv, y/18, orig.Sens[i].Time)
+		}
+	}
+	if x, _ := data.TargetLow[0].Float(); !closeEnough(x, 100.0/18) {
+		t.Errorf("normalized target_low == %v", x)
+	}
+	// Basal rates and carb ratios are not glucose values.
+	if x, _ := data.Basal[1].Float(); x != 1.1 {
+		t.Errorf("normalized basal == %v, want 1.1", x)
+	}
+	// The original profile is unchanged.
+	if x, _ := orig.Sens[0].Float(); x != 50 {
+		t.Errorf("original sens changed to %v", x)
+	}
+	back, err := data.Normalize(MgdlUnits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := back.TargetHigh[0].Float(); !closeEnough(x, 120) {
+		t.Errorf("target_high after round trip == %v, want 120", x)
+	}
+	_, err = ProfileData{Units: "furlongs"}.Normalize(MgdlUnits)
+	if err == nil {
+		t.Errorf("Normalize with unknown units succeeded")
+	}
+}
+
+func TestTreatmentUnits(t *testing.T) {
+	cases := []struct {
+		json    string
+		glucose Glucose
+		bottom  float64
+		out     string
+	}{
+		{`{"eventType":"BG Check","glucose":120,"units":"mg/dl"}`, 120, 0,
+			`{"created_at":"0001-01-01T00:00:00Z","eventType":"BG Check","units":"mg/dl","glucose":120}`},
+		{`{"eventType":"BG Check","glucose":"120"}`, 120, 0,
+			`{"created_at":"0001-01-01T00:00:00Z","eventType":"BG Check","glucose":120}`},
+		{`{"eventType":"BG Check","glucose":5.5,"units":"mmol"}`, 99, 0,
+			`{"created_at":"0001-01-01T00:00:00Z","eventType":"BG Check","units":"mmol","glucose":5.5}`},
+		{`{"eventType":"BG Check","glucose":"6.2","units":"mmol"}`, 112, 0,
+			`{"created_at":"0001-01-01T00:00:00Z","eventType":"BG Check","units":"mmol","glucose":6.2}`},
+		{`{"eventType":"BG Check","glucose":"","units":"mmol"}`, 0, 0,
+			`{"created_at":"0001-01-01T00:00:00Z","eventType":"BG Check","units":"mmol"}`},
+		// Targets are kept as stored.
+		{`{"eventType":"Temporary Target","targetBottom":5,"targetTop":5.5,"units":"mmol"}`, 0, 90,
+			`{"created_at":"0001-01-01T00:00:00Z","eventType":"Temporary Target","targetTop":5.5,"targetBottom":5,"units":"mmol"}`},
+		{`{"eventType":"Temporary Target","targetBottom":90,"targetTop":108,"units":"mmol"}`, 0, 90,
+			`{"created_at":"0001-01-01T00:00:00Z","eventType":"Temporary Target","targetTop":108,"targetBottom":90,"units":"mmol"}`},
+	}
+	for _, c := range cases {
+		var r Treatment
+		err := json.Unmarshal([]byte(c.json), &r)
+		if err != nil {
+			t.Errorf("Unmarshal(%s) returned %v", c.json, err)
+			continue
+		}
+		if c.glucose != 0 && (r.Glucose == nil || *r.Glucose != c.glucose) {
+			t.Errorf("Unmarshal(%s) glucose == %v, want %v", c.json, r.Glucose, c.glucose)
+		}
+		if c.glucose == 0 && r.Glucose != nil {
+			t.Errorf("Unmarshal(%s) glucose == %v, want nil", c.json, *r.Glucose)
+		}
+		if bottom, _, _ := r.Target(MgdlUnits); bottom != c.bottom {
+			t.Errorf("Unmarshal(%s) target bottom == %v mg/dL, want %v", c.json, bottom, c.bottom)
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != c.out {
+			t.Errorf("Marshal(%+v) == %s, want %s", r, data, c.out)
+		}
+	}
+	var r Treatment
+	err := json.Unmarshal([]byte(`{"eventType":"BG Check","glucose":"high"}`), &r)
+	if err == nil {
+		t.Errorf("Unmarshal with invalid glucose succeeded")
+	}
+}
+
+func TestTreatmentTarget(t *testing.T) {
+	cases := []struct {
+		r      Treatment
+		unit   GlucoseUnit
+		bottom float64
+		top    float64
+		ok     bool
+	}{
+		{NewTemporaryTarget(time.Time{}, 90, 108, 60, ""), MgdlUnits, 90, 108, true},
+		{NewTemporaryTarget(time.Time{}, 90, 108, 60, ""), MmolUnits, 5, 6, true},
+		{Treatment{Units: MmolUnits, TargetBottom: floatPtr(5), TargetTop: floatPtr(6)}, MgdlUnits, 90, 108, true},
+		{Treatment{Units: MmolUnits, TargetBottom: floatPtr(5), TargetTop: floatPtr(6)}, MmolUnits, 5, 6, true},
+		// Nightscout stores targets in mg/dL even for mmol/L treatments.
+		{Treatment{Units: MmolUnits, TargetBottom: floatPtr(90), TargetTop: floatPtr(108)}, MmolUnits, 5, 6, true},
+		{NewTemporaryTargetCancel(time.Time{}), MgdlUnits, 0, 0, false},
+	}
+	for _, c := range cases {
+		bottom, top, ok := c.r.Target(c.unit)
+		if !closeEnough(bottom, c.bottom) || !closeEnough(top, c.top) || ok != c.ok {
+			t.Errorf("%+v Target(%v) == %v, %v, %v, want %v, %v, %v", c.r, c.unit, bottom, top, ok, c.bottom, c.top, c.ok)
+		}
+	}
+}
+
+func TestTreatmentRoundTrip(t *testing.T) {
+	inputs := []string{
+		`{"created_at":"2018-06-30T16:00:00Z","eventType":"Temporary Target","duration":60,"targetTop":5.5,"targetBottom":5,"units":"mmol"}`,
+		`{"created_at":"2018-06-30T16:00:00Z","eventType":"Temporary Target","duration":60,"targetTop":108,"targetBottom":90,"units":"mmol"}`,
+		`{"created_at":"2018-06-30T16:00:00Z","eventType":"BG Check","glucoseType":"Finger","units":"mmol","glucose":5.5}`,
+		`{"created_at":"2018-06-30T16:00:00Z","eventType":"BG Check","glucoseType":"Finger","units":"mg/dl","glucose":99}`,
+	}
+	for _, in := range inputs {
+		var r Treatment
+		err := json.Unmarshal([]byte(in), &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != in {
+			t.Errorf("round trip of %s produced %s", in, out)
+		}
+	}
+}
+
+func TestTreatmentInvalidGlucose(t *testing.T) {
+	var r Treatment
+	err := json.Unmarshal([]byte(`{"eventType":"BG Check","glucose":true}`), &r)
+	if err == nil {
+		t.Errorf("Unmarshal with invalid glucose succeeded")
+	}
+}
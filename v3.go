@@ -0,0 +1,388 @@
+package nightscout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// V3Client is a client for the Nightscout API v3.
+// Requests are authorized by a JWT obtained from an access token.
+type V3Client struct {
+	URL    *url.URL
+	Client *http.Client
+	// Token is the access token used to obtain a JWT.
+	// If empty, the value of NIGHTSCOUT_API_SECRET is used.
+	Token   string
+	verbose bool
+	retry   RetryPolicy
+
+	mu         sync.Mutex
+	jwt        string
+	jwtExpires time.Time
+}
+
+// Nightscout API v3 collections.
+const (
+	DeviceStatusCollection = "devicestatus"
+	EntriesCollection      = "entries"
+	FoodCollection         = "food"
+	ProfileCollection      = "profile"
+	SettingsCollection     = "settings"
+	TreatmentsCollection   = "treatments"
+)
+
+const (
+	// Refresh the JWT this long before it expires.
+	jwtMargin = time.Minute
+)
+
+type (
+	// Document represents a Nightscout API v3 document.
+	Document map[string]interface{}
+
+	// LastModified represents the response of the API v3 lastModified operation.
+	LastModified struct {
+		SrvDate     int64            `json:"srvDate"`     // Unix time in milliseconds
+		Collections map[string]int64 `json:"collections"` // Unix time in milliseconds
+	}
+
+	// v3Response represents the envelope of an API v3 response.
+	v3Response struct {
+		Status       int             `json:"status"`
+		Result       json.RawMessage `json:"result"`
+		Identifier   string          `json:"identifier"`
+		LastModified int64           `json:"lastModified"`
+	}
+
+	// authorization represents the response of the API v2 authorization request.
+	authorization struct {
+		Token string `json:"token"`
+		Exp   int64  `json:"exp"` // Unix time in seconds
+	}
+)
+
+// SiteV3 returns an API v3 client for the given Nightscout site.
+func SiteV3(site string) (*V3Client, error) {
+	u, err := url.Parse(site)
+	if err != nil {
+		return nil, err
+	}
+	return &V3Client{
+		URL:    u,
+		Client: &http.Client{},
+	}, nil
+}
+
+// DefaultSiteV3 returns an API v3 client for the site specified by NIGHTSCOUT_SITE.
+func DefaultSiteV3() (*V3Client, error) {
+	site := os.Getenv(siteEnvVar)
+	if len(site) == 0 {
+		return nil, fmt.Errorf("%s is not set", siteEnvVar)
+	}
+	return SiteV3(site)
+}
+
+func (c *V3Client) String() string {
+	return c.URL.String()
+}
+
+// Verbose returns the value of the verbose flag.
+func (c *V3Client) Verbose() bool {
+	return c.verbose
+}
+
+// SetVerbose sets the value of the verbose flag.
+func (c *V3Client) SetVerbose(flag bool) {
+	c.verbose = flag
+}
+
+// RetryPolicy returns the retry policy.
+func (c *V3Client) RetryPolicy() RetryPolicy {
+	return c.retry
+}
+
+// SetRetryPolicy sets the retry policy.
+func (c *V3Client) SetRetryPolicy(p RetryPolicy) {
+	c.retry = p
+}
+
+func (c *V3Client) accessToken() (string, error) {
+	token := c.Token
+	if len(token) == 0 {
+		token = os.Getenv(apiSecretEnvVar)
+		if len(token) == 0 {
+			return "", fmt.Errorf("%s is not set", apiSecretEnvVar)
+		}
+	}
+	token = strings.TrimPrefix(token, "token=")
+	if !validToken.MatchString(token) {
+		// Don't include the token, which may be a secret.
+		return "", fmt.Errorf("invalid Nightscout token")
+	}
+	return token, nil
+}
+
+// Authorize exchanges the access token for a JWT.
+// It is called automatically when needed.
+func (c *V3Client) Authorize(ctx context.Context) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+	u := c.resolve("api/v2/authorization/request/"+url.PathEscape(token), nil)
+	resp, err := c.retry.do(ctx, c.Client, c.verbose, func(attempt int) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("accept", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	var a authorization
+	err = json.NewDecoder(resp.Body).Decode(&a)
+	if err != nil {
+		return err
+	}
+	if len(a.Token) == 0 {
+		return fmt.Errorf("no JWT in Nightscout authorization response")
+	}
+	c.mu.Lock()
+	c.jwt = a.Token
+	c.jwtExpires = time.Unix(a.Exp, 0)
+	c.mu.Unlock()
+	return nil
+}
+
+// bearer returns a valid JWT, obtaining a new one if necessary.
+func (c *V3Client) bearer(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	jwt, exp := c.jwt, c.jwtExpires
+	c.mu.Unlock()
+	if len(jwt) != 0 && time.Now().Add(jwtMargin).Before(exp) {
+		return jwt, nil
+	}
+	err := c.Authorize(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.jwt, nil
+}
+
+// invalidate discards the current JWT.
+func (c *V3Client) invalidate() {
+	c.mu.Lock()
+	c.jwt = ""
+	c.mu.Unlock()
+}
+
+func (c *V3Client) resolve(api string, params url.Values) string {
+	u := &url.URL{Path: api}
+	if len(params) != 0 {
+		u.RawQuery = params.Encode()
+	}
+	return c.URL.ResolveReference(u).String()
+}
+
+// restOperation performs an API v3 operation and returns the response envelope.
+// If the server rejects the JWT, a new one is obtained and the operation is retried once.
+func (c *V3Client) restOperation(ctx context.Context, op string, api string, params url.Values, data interface{}) (*v3Response, http.Header, error) {
+	for i := 0; ; i++ {
+		resp, header, err := c.tryOperation(ctx, op, api, params, data)
+		if i == 0 && IsUnauthorized(err) {
+			c.invalidate()
+			continue
+		}
+		return resp, header, err
+	}
+}
+
+func (c *V3Client) tryOperation(ctx context.Context, op string, api string, params url.Values, data interface{}) (*v3Response, http.Header, error) {
+	jwt, err := c.bearer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	u := c.resolve(path.Join("api/v3", api), params)
+	resp, err := c.retry.do(ctx, c.Client, c.verbose, func(attempt int) (*http.Request, error) {
+		r, err := makeReader(data)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, op, u, r)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("accept", "application/json")
+		req.Header.Add("content-type", "application/json")
+		req.Header.Add("authorization", "Bearer "+jwt)
+		if c.verbose && attempt == 1 {
+			log.Printf("%s %s", op, u)
+			if data != nil {
+				log.Print(JSON(data))
+			}
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	default:
+		return nil, nil, newAPIError(resp)
+	}
+	var body json.RawMessage
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		if err == io.EOF {
+			return &v3Response{Status: resp.StatusCode}, resp.Header, nil
+		}
+		return nil, nil, err
+	}
+	return unwrapV3(resp.StatusCode, body), resp.Header, nil
+}
+
+// unwrapV3 handles both enveloped responses (cgm-remote-monitor 15 and later)
+// and bare responses (earlier versions).
+func unwrapV3(status int, body json.RawMessage) *v3Response {
+	var env struct {
+		v3Response
+		Status *int `json:"status"`
+	}
+	if json.Unmarshal(body, &env) == nil && env.Status != nil {
+		r := env.v3Response
+		r.Status = *env.Status
+		return &r
+	}
+	return &v3Response{Status: status, Result: body}
+}
+
+func decodeResult(r *v3Response, result interface{}) error {
+	if result == nil || len(r.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Result, result)
+}
+
+// Search retrieves documents from a collection.
+// The params may include filters such as date$gte, as well as limit, skip, sort, and fields.
+func (c *V3Client) Search(ctx context.Context, collection string, params url.Values, result interface{}) error {
+	r, _, err := c.restOperation(ctx, "GET", collection, params, nil)
+	if err != nil {
+		return err
+	}
+	return decodeResult(r, result)
+}
+
+// Read retrieves the document with the given identifier.
+func (c *V3Client) Read(ctx context.Context, collection string, identifier string, result interface{}) error {
+	r, _, err := c.restOperation(ctx, "GET", path.Join(collection, identifier), nil, nil)
+	if err != nil {
+		return err
+	}
+	return decodeResult(r, result)
+}
+
+// Create adds a document to a collection and returns its identifier.
+func (c *V3Client) Create(ctx context.Context, collection string, doc interface{}) (string, error) {
+	r, header, err := c.restOperation(ctx, "POST", collection, nil, doc)
+	if err != nil {
+		return "", err
+	}
+	if len(r.Identifier) != 0 {
+		return r.Identifier, nil
+	}
+	if loc := header.Get("Location"); len(loc) != 0 {
+		return path.Base(loc), nil
+	}
+	return "", nil
+}
+
+// Update replaces the document with the given identifier.
+func (c *V3Client) Update(ctx context.Context, collection string, identifier string, doc interface{}) error {
+	_, _, err := c.restOperation(ctx, "PUT", path.Join(collection, identifier), nil, doc)
+	return err
+}
+
+// Patch modifies the given fields of the document with the given identifier.
+func (c *V3Client) Patch(ctx context.Context, collection string, identifier string, fields interface{}) error {
+	_, _, err := c.restOperation(ctx, "PATCH", path.Join(collection, identifier), nil, fields)
+	return err
+}
+
+// Delete deletes the document with the given identifier.
+// Nightscout marks the document as invalid rather than removing it,
+// so that the deletion is visible in the collection history.
+func (c *V3Client) Delete(ctx context.Context, collection string, identifier string) error {
+	_, _, err := c.restOperation(ctx, "DELETE", path.Join(collection, identifier), nil, nil)
+	return err
+}
+
+// History retrieves up to limit documents in a collection
+// that were modified after the given srvModified time (Unix time in milliseconds),
+// in order of modification.
+// Deleted documents are included with isValid set to false.
+// A limit of 0 uses the server default.
+func (c *V3Client) History(ctx context.Context, collection string, since int64, limit int, result interface{}) error {
+	var params url.Values
+	if limit > 0 {
+		params = url.Values{}
+		params.Add("limit", strconv.Itoa(limit))
+	}
+	api := path.Join(collection, "history", strconv.FormatInt(since, 10))
+	r, _, err := c.restOperation(ctx, "GET", api, params, nil)
+	if err != nil {
+		return err
+	}
+	return decodeResult(r, result)
+}
+
+// LastModified retrieves the time of the most recent modification of each collection.
+func (c *V3Client) LastModified(ctx context.Context) (LastModified, error) {
+	var m LastModified
+	r, _, err := c.restOperation(ctx, "GET", "lastModified", nil, nil)
+	if err != nil {
+		return m, err
+	}
+	err = decodeResult(r, &m)
+	return m, err
+}
+
+// Identifier returns the identifier of a document.
+func (d Document) Identifier() string {
+	s, _ := d["identifier"].(string)
+	return s
+}
+
+// SrvModified returns the server modification time of a document
+// as Unix time in milliseconds.
+func (d Document) SrvModified() int64 {
+	n, _ := d["srvModified"].(float64)
+	return int64(n)
+}
+
+// IsValid returns false if the document has been deleted.
+func (d Document) IsValid() bool {
+	v, ok := d["isValid"].(bool)
+	return !ok || v
+}
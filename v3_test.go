@@ -0,0 +1,225 @@
+package nightscout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAccessToken = "tester-0123456789abcdef"
+
+// v3Server is a minimal stand-in for the Nightscout API v3.
+type v3Server struct {
+	mu        sync.Mutex
+	docs      map[string]Document
+	nextID    int
+	clock     int64
+	jwts      int
+	expireJWT bool
+}
+
+func (s *v3Server) jwt() string {
+	return fmt.Sprintf("jwt-%d", s.jwts)
+}
+
+func (s *v3Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if strings.HasPrefix(p, "api/v2/authorization/request/") {
+		if strings.TrimPrefix(p, "api/v2/authorization/request/") != testAccessToken {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.jwts++
+		s.reply(rw, http.StatusOK, authorization{Token: s.jwt(), Exp: time.Now().Add(time.Hour).Unix()})
+		return
+	}
+	if s.expireJWT || r.Header.Get("authorization") != "Bearer "+s.jwt() {
+		s.expireJWT = false
+		s.reply(rw, http.StatusUnauthorized, map[string]interface{}{"status": 401, "message": "Bad access token or JWT"})
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(p, "api/v3/"), "/")
+	switch {
+	case parts[0] == "lastModified":
+		s.envelope(rw, http.StatusOK, LastModified{SrvDate: s.clock, Collections: map[string]int64{"entries": s.clock}})
+	case len(parts) == 1 && r.Method == "GET":
+		s.envelope(rw, http.StatusOK, s.matching(func(d Document) bool { return d.IsValid() }))
+	case len(parts) == 1 && r.Method == "POST":
+		var d Document
+		_ = json.NewDecoder(r.Body).Decode(&d)
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		d["identifier"] = id
+		s.modify(id, d)
+		s.reply(rw, http.StatusCreated, map[string]interface{}{"status": 201, "identifier": id, "lastModified": s.clock})
+	case len(parts) == 3 && parts[1] == "history":
+		since, _ := strconv.ParseInt(parts[2], 10, 64)
+		s.envelope(rw, http.StatusOK, s.matching(func(d Document) bool { return d.SrvModified() > since }))
+	case len(parts) == 2:
+		d, ok := s.docs[parts[1]]
+		if !ok {
+			s.reply(rw, http.StatusNotFound, map[string]interface{}{"status": 404})
+			return
+		}
+		switch r.Method {
+		case "GET":
+			s.envelope(rw, http.StatusOK, d)
+		case "PUT", "PATCH":
+			var u Document
+			_ = json.NewDecoder(r.Body).Decode(&u)
+			if r.Method == "PUT" {
+				d = Document{"identifier": parts[1]}
+			}
+			for k, v := range u {
+				d[k] = v
+			}
+			s.modify(parts[1], d)
+			s.envelope(rw, http.StatusOK, nil)
+		case "DELETE":
+			d["isValid"] = false
+			s.modify(parts[1], d)
+			s.envelope(rw, http.StatusOK, nil)
+		}
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *v3Server) modify(id string, d Document) {
+	s.clock++
+	d["srvModified"] = float64(s.clock)
+	s.docs[id] = d
+}
+
+func (s *v3Server) matching(f func(Document) bool) []Document {
+	var v []Document
+	for _, d := range s.docs {
+		if f(d) {
+			v = append(v, d)
+		}
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i].SrvModified() < v[j].SrvModified() })
+	return v
+}
+
+func (s *v3Server) envelope(rw http.ResponseWriter, status int, result interface{}) {
+	s.reply(rw, status, map[string]interface{}{"status": status, "result": result})
+}
+
+func (s *v3Server) reply(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("content-type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+func TestV3Client(t *testing.T) {
+	s := &v3Server{docs: make(map[string]Document)}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c, err := SiteV3(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token = "token=" + testAccessToken
+	ctx := context.Background()
+
+	id1, err := c.Create(ctx, EntriesCollection, Entry{Type: SGVType, Date: 1000, SGV: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := c.Create(ctx, EntriesCollection, Entry{Type: SGVType, Date: 2000, SGV: 110})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e Entry
+	err = c.Read(ctx, EntriesCollection, id2, &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.SGV != 110 {
+		t.Errorf("Read(%s) returned %+v", id2, e)
+	}
+	err = c.Patch(ctx, EntriesCollection, id1, map[string]interface{}{"sgv": 105})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.LastModified(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Collections[EntriesCollection] != 3 {
+		t.Errorf("LastModified returned %+v", m)
+	}
+
+	// Force the JWT to be renewed.
+	s.expireJWT = true
+	err = c.Delete(ctx, EntriesCollection, id2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.jwts != 2 {
+		t.Errorf("obtained %d JWTs, want 2", s.jwts)
+	}
+
+	var entries Entries
+	err = c.Search(ctx, EntriesCollection, nil, &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].SGV != 105 {
+		t.Errorf("Search returned %+v", entries)
+	}
+	var history []Document
+	err = c.History(ctx, EntriesCollection, 2, 0, &history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Identifier() != id1 || history[1].Identifier() != id2 || history[1].IsValid() {
+		t.Errorf("History returned %+v", history)
+	}
+	err = c.Read(ctx, EntriesCollection, "nonexistent", &e)
+	if !IsNotFound(err) {
+		t.Errorf("Read(nonexistent) returned %v", err)
+	}
+}
+
+func TestV3BadToken(t *testing.T) {
+	s := &v3Server{docs: make(map[string]Document)}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c, err := SiteV3(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token = "tester-fedcba9876543210"
+	err = c.Search(context.Background(), EntriesCollection, nil, nil)
+	if !IsUnauthorized(err) {
+		t.Errorf("Search returned %v", err)
+	}
+	if strings.Contains(err.Error(), "fedcba9876543210") {
+		t.Errorf("%v does not redact token", err)
+	}
+	// Malformed tokens are not exposed.
+	c.Token = "not a token fedcba9876543210"
+	err = c.Search(context.Background(), EntriesCollection, nil, nil)
+	if err == nil || strings.Contains(err.Error(), "fedcba9876543210") {
+		t.Errorf("Search with malformed token returned %v", err)
+	}
+	c.Token = "tester-fedcba9876543210"
+	// Transport errors do not expose the token either.
+	server.Close()
+	err = c.Search(context.Background(), EntriesCollection, nil, nil)
+	if err == nil || strings.Contains(err.Error(), "fedcba9876543210") {
+		t.Errorf("Search with server down returned %v", err)
+	}
+}
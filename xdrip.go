@@ -1,17 +1,25 @@
 package nightscout
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
 
+// XDripTime returns the current time reported by an xDrip web service.
 func (w Website) XDripTime() (time.Time, error) {
+	return w.XDripTimeContext(context.Background())
+}
+
+// XDripTimeContext returns the current time reported by an xDrip web service,
+// using the given context.
+func (w Website) XDripTimeContext(ctx context.Context) (time.Time, error) {
 	var p struct {
 		Status []struct {
 			Now int64 `json:"now"` // Unix time in milliseconds
 		} `json:"status"`
 	}
-	err := w.Get("pebble", &p)
+	err := w.GetContext(ctx, "pebble", &p)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -21,8 +29,15 @@ func (w Website) XDripTime() (time.Time, error) {
 	return msecsToTime(p.Status[0].Now), nil
 }
 
+// XDripEntries returns the entries provided by an xDrip web service.
 func (w Website) XDripEntries() (Entries, error) {
+	return w.XDripEntriesContext(context.Background())
+}
+
+// XDripEntriesContext returns the entries provided by an xDrip web service,
+// using the given context.
+func (w Website) XDripEntriesContext(ctx context.Context) (Entries, error) {
 	var entries Entries
-	err := w.Get("sgv.json", &entries)
+	err := w.GetContext(ctx, "sgv.json", &entries)
 	return entries, err
 }